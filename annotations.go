@@ -0,0 +1,53 @@
+package kedge
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// hashAnnotation stores a hash of the object as last rendered by kedge. It
+	// is used by Options.SkipUnchanged to detect that nothing changed.
+	hashAnnotation = "kedge.io/last-applied-hash"
+
+	// lastAppliedAnnotation is the annotation kubectl apply uses to store the
+	// configuration it last applied. kedge uses the same key so both tools
+	// can compute 3-way merges against each others applies.
+	lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+	// sourceTemplateAnnotation and sourceValuesAnnotation record what an
+	// object was rendered from. See Options.SourceAnnotations.
+	sourceTemplateAnnotation = "kedge.io/source-template"
+	sourceValuesAnnotation   = "kedge.io/source-values"
+)
+
+// objectHash returns a stable hash of the object content. encoding/json
+// sorts map keys so the same object always produces the same hash.
+func objectHash(obj *unstructured.Unstructured) (string, error) {
+	b, err := json.Marshal(obj.Object)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func setAnnotation(obj *unstructured.Unstructured, key, value string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[key] = value
+	obj.SetAnnotations(annotations)
+}
+
+// setSourceAnnotations records the template and value files obj was rendered
+// from, value files are comma separated.
+func setSourceAnnotations(obj *unstructured.Unstructured, template string, values []string) {
+	setAnnotation(obj, sourceTemplateAnnotation, template)
+	setAnnotation(obj, sourceValuesAnnotation, strings.Join(values, ","))
+}
@@ -0,0 +1,195 @@
+package kedge
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/client-go/rest"
+)
+
+// ApplyChart applies a directory laid out like a Helm chart:
+//
+//	Chart.yaml        optional, provides .Chart
+//	values.yaml       optional, the base values
+//	templates/        every file is rendered, except files starting with
+//	                  "_" which are loaded as partials, eg _helpers.tpl
+//
+// extraValues are merged on top of values.yaml, then what the options add to
+// them like Set and ValueLayers, as for Apply. Templates always see Helm's
+// layout of Options.HelmValues: the values as .Values, the namespace as
+// .Release.Namespace and Chart.yaml as .Chart. Partials can be used with
+// include. The rendered objects are applied in install order.
+//
+// This is not a Helm implementation, there's no support for dependencies,
+// hooks or the Capabilities object.
+func ApplyChart(config *rest.Config, chartDir, namespace string, extraValues []string) error {
+	_, err := ApplyChartWithOptions(config, chartDir, namespace, extraValues, Options{InstallOrder: true})
+	return err
+}
+
+// ApplyChartWithOptions is ApplyChart using opts.
+func ApplyChartWithOptions(config *rest.Config, chartDir, namespace string, extraValues []string, opts Options) ([]Result, error) {
+	opts.liveConfig = config
+	b, values, namespace, err := renderChart(chartDir, namespace, extraValues, opts)
+	if err != nil {
+		return nil, err
+	}
+	a := newApplier(config, opts).withSource(chartDir, extraValues)
+	err = a.applyManifest(b, namespace)
+	if opts.RecordRelease {
+		release := &Release{
+			Name:       chartReleaseName(chartDir, opts),
+			Namespace:  namespace,
+			Source:     chartDir,
+			ValueFiles: extraValues,
+			Values:     values,
+			Manifest:   string(b),
+			Options:    releaseOptions(opts),
+		}
+		if recordErr := a.recordRelease(release, err); recordErr != nil && err == nil {
+			err = recordErr
+		}
+	}
+	return a.results, err
+}
+
+// renderChart renders the templates of a chart. It returns the rendered
+// manifest along with the values and the resolved namespace.
+func renderChart(chartDir, namespace string, extraValues []string, opts Options) ([]byte, map[string]interface{}, string, error) {
+	valueFilenames := []string{}
+	base := filepath.Join(chartDir, "values.yaml")
+	if _, err := os.Stat(base); err == nil {
+		valueFilenames = append(valueFilenames, base)
+	}
+	valueFilenames = append(valueFilenames, extraValues...)
+	values, err := mergeValues(valueFilenames, opts)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	namespace, err = resolveNamespace(namespace, values)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	chart, err := readChart(chartDir)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	// Chart.yaml keys are lowercase but templates use .Chart.Name
+	chartData := map[string]interface{}{}
+	for k, v := range chart {
+		chartData[strings.ToUpper(k[:1])+k[1:]] = v
+	}
+	releaseName := chartReleaseName(chartDir, opts)
+
+	partials, templates, err := chartTemplates(filepath.Join(chartDir, "templates"))
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	b, err := renderPasses(opts, func(opts Options) ([]byte, error) {
+		return renderChartTemplates(chartDir, namespace, releaseName, values, chartData, partials, templates, opts)
+	})
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if opts.StrictYAML {
+		if err := checkStrictManifest(splitDocuments(b)); err != nil {
+			return nil, nil, "", err
+		}
+	}
+	return b, values, namespace, nil
+}
+
+// readChart reads the Chart.yaml of a chart, which is optional.
+func readChart(chartDir string) (map[string]interface{}, error) {
+	chart := map[string]interface{}{}
+	if content, err := ioutil.ReadFile(filepath.Join(chartDir, "Chart.yaml")); err == nil {
+		if err := yaml.Unmarshal(content, &chart); err != nil {
+			return nil, fmt.Errorf("could not read Chart.yaml: %s", err)
+		}
+	}
+	return chart, nil
+}
+
+// chartReleaseName is .Release.Name of the templates of a chart:
+// Options.ReleaseName, the name of Chart.yaml or the name of the directory.
+func chartReleaseName(chartDir string, opts Options) string {
+	if opts.ReleaseName != "" {
+		return opts.ReleaseName
+	}
+	chart, _ := readChart(chartDir)
+	if name, _ := chart["name"].(string); name != "" {
+		return name
+	}
+	return filepath.Base(chartDir)
+}
+
+// renderChartTemplates renders the templates of a chart one after the other.
+func renderChartTemplates(chartDir, namespace, releaseName string, values, chartData map[string]interface{}, partials, templates []string, opts Options) ([]byte, error) {
+	var err error
+	out := bytes.NewBuffer([]byte{})
+	for _, templateFile := range templates {
+		data := map[string]interface{}{
+			"Values": values,
+			"Chart":  chartData,
+			"Release": map[string]interface{}{
+				"Name":      releaseName,
+				"Namespace": namespace,
+			},
+			"Files": newFiles(chartDir),
+		}
+		tpl := newTemplate(filepath.Base(templateFile), newFiles(chartDir), templateFuncs(opts))
+		if len(partials) > 0 {
+			if tpl, err = tpl.ParseFiles(partials...); err != nil {
+				return nil, fmt.Errorf("could not parse partials: %s", err)
+			}
+		}
+		if tpl, err = tpl.ParseFiles(templateFile); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %s", templateFile, err)
+		}
+		buf := bytes.NewBuffer([]byte{})
+		if err := tpl.ExecuteTemplate(buf, filepath.Base(templateFile), data); err != nil {
+			return nil, fmt.Errorf("could not render %s: %s", templateFile, err)
+		}
+		out.WriteString("---\n")
+		out.Write(buf.Bytes())
+		out.WriteString("\n")
+	}
+	return out.Bytes(), nil
+}
+
+// chartTemplates walks the templates directory of a chart and returns the
+// partials and the templates to render, each sorted by path.
+func chartTemplates(dir string) ([]string, []string, error) {
+	partials := []string{}
+	templates := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		switch {
+		case strings.HasPrefix(info.Name(), "_"):
+			partials = append(partials, path)
+		case info.Name() == "NOTES.txt":
+		default:
+			templates = append(templates, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read chart templates: %s", err)
+	}
+	sort.Strings(partials)
+	sort.Strings(templates)
+	return partials, templates, nil
+}
@@ -0,0 +1,82 @@
+package kedge
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeChart writes a chart with files, by path relative to the chart, to a
+// temporary directory.
+func writeChart(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+var webChart = map[string]string{
+	"Chart.yaml":  "name: web\n",
+	"values.yaml": "level: info\nlimits:\n  cpu: \"1\"\n",
+	"templates/settings.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}
+data:
+  level: {{ .Values.level }}
+  cpu: "{{ .Values.limits.cpu }}"
+  memory: {{ .Values.limits.memory }}
+`,
+}
+
+func TestRenderChartSetJSON(t *testing.T) {
+	opts := Options{
+		Set:     []string{"level=debug"},
+		SetJSON: []string{`limits={"memory":"1Gi"}`},
+	}
+	b, _, namespace, err := renderChart(writeChart(t, webChart), "team", nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if namespace != "team" {
+		t.Errorf("got namespace %q, want team", namespace)
+	}
+	for _, want := range []string{"name: web", "level: debug", `cpu: "1"`, "memory: 1Gi"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("got\n%s\nwant %q in it", b, want)
+		}
+	}
+}
+
+func TestRenderChartStrictYAML(t *testing.T) {
+	chart := map[string]string{
+		"templates/settings.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n  name: b\n",
+	}
+	if _, _, _, err := renderChart(writeChart(t, chart), "team", nil, Options{StrictYAML: true}); err == nil {
+		t.Error("got no error, want the duplicate key rejected")
+	}
+}
+
+func TestApplyChartRecordRelease(t *testing.T) {
+	cluster, _ := newTestCluster()
+	opts := Options{Cluster: cluster, InstallOrder: true, RecordRelease: true, Set: []string{"level=debug"}}
+	if _, err := ApplyChartWithOptions(nil, writeChart(t, webChart), "team", nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	releases, err := newApplier(nil, opts).listReleases("team", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != 1 || releases[0].Values["level"] != "debug" {
+		t.Fatalf("got %v, want a single revision of web with level=debug", releases)
+	}
+}
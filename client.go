@@ -0,0 +1,108 @@
+package kedge
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+)
+
+const modulePath = "github.com/isaaguilar/kedge"
+
+// Version returns the version of kedge as recorded in the build info of the
+// binary using it, or "dev" when it's unknown, eg when built from a checkout.
+func Version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+	if info.Main.Path == modulePath && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			return dep.Version
+		}
+	}
+	return "dev"
+}
+
+// ProtobufConfig returns a copy of config sending and accepting protobuf,
+// with JSON as a fallback, which makes large built-in objects cheaper to
+// transfer, eg for WaitForJob and typed clientsets. Objects applied by kedge
+// always go through the dynamic client as JSON since unstructured objects,
+// and custom resources in general, have no protobuf encoding.
+func ProtobufConfig(config *rest.Config) *rest.Config {
+	config = rest.CopyConfig(config)
+	config.ContentType = runtime.ContentTypeProtobuf
+	config.AcceptContentTypes = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
+	return config
+}
+
+// newApplier returns an applier using a copy of config modified by opts. The
+// caller's config is never changed.
+func newApplier(config *rest.Config, opts Options) *applier {
+	if config == nil {
+		// applies to an Options.Cluster may have no config
+		config = &rest.Config{}
+	}
+	config = rest.CopyConfig(config)
+	if opts.UserAgent != "" {
+		config.UserAgent = opts.UserAgent
+	} else if config.UserAgent == "" {
+		config.UserAgent = "kedge/" + Version()
+	}
+	if len(opts.Headers) > 0 {
+		headers := opts.Headers.Clone()
+		config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &headerRoundTripper{headers: headers, next: rt}
+		})
+	}
+	if opts.Impersonate.UserName != "" || len(opts.Impersonate.Groups) > 0 {
+		config.Impersonate = opts.Impersonate
+	}
+	warnings := &warningCollector{logger: opts.logger()}
+	config.WarningHandler = warnings
+	if opts.ConfigHook != nil {
+		opts.ConfigHook(config)
+	}
+	a := &applier{config: config, opts: opts, warnings: warnings, discovery: newDiscoveryCache(config, opts)}
+	a.cluster = opts.Cluster
+	if a.cluster == nil {
+		a.cluster = &restCluster{config: config, cache: a.discovery, logger: opts.logger()}
+	}
+	return a
+}
+
+// explainError makes it clear when a request was forbidden for the
+// impersonated user rather than for the user of the config.
+func (a *applier) explainError(err error) error {
+	if err == nil || !kerrors.IsForbidden(err) {
+		return err
+	}
+	impersonate := a.config.Impersonate
+	if impersonate.UserName == "" && len(impersonate.Groups) == 0 {
+		return err
+	}
+	return fmt.Errorf("forbidden while impersonating user %q with groups %v, check the RBAC rules of the impersonated user: %w", impersonate.UserName, impersonate.Groups, err)
+}
+
+// headerRoundTripper adds headers to every request.
+type headerRoundTripper struct {
+	headers http.Header
+	next    http.RoundTripper
+}
+
+func (rt *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the request they are given
+	req = req.Clone(req.Context())
+	for key, values := range rt.headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	return rt.next.RoundTrip(req)
+}
@@ -0,0 +1,32 @@
+package kedge
+
+import (
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestNewApplierUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		userAgent string
+		want      string
+	}{
+		{"default", "", "", "kedge/" + Version()},
+		{"config", "deployer/1.2", "", "deployer/1.2"},
+		{"option", "deployer/1.2", "ci", "ci"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &rest.Config{UserAgent: tt.config}
+			a := newApplier(config, Options{UserAgent: tt.userAgent})
+			if a.config.UserAgent != tt.want {
+				t.Errorf("got %q, want %q", a.config.UserAgent, tt.want)
+			}
+			if config.UserAgent != tt.config {
+				t.Errorf("got the config changed to %q", config.UserAgent)
+			}
+		})
+	}
+}
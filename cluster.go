@@ -0,0 +1,166 @@
+package kedge
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// Cluster is what applying objects needs of a cluster: the API resources it
+// serves, like discovery, and a dynamic client to create, patch, get and
+// delete objects with. Options.Cluster replaces the cluster of the config
+// with one, eg a StaticCluster wrapping the fake client of
+// k8s.io/client-go/dynamic/fake in tests, and every request of the apply
+// goes through it.
+type Cluster interface {
+	// Resource returns the resource serving gvk, a NoResourceError when
+	// there is none.
+	Resource(gvk schema.GroupVersionKind) (metav1.APIResource, error)
+	// Resources returns the resources of a group version, subresources like
+	// "deployments/status" included, with their Group and Version set.
+	Resources(groupVersion string) ([]metav1.APIResource, error)
+	// PreferredResources returns the resources of the preferred version of
+	// every group, with their Group and Version set, eg to find the objects
+	// to prune.
+	PreferredResources() ([]metav1.APIResource, error)
+	// Dynamic returns the client objects are sent with.
+	Dynamic() (dynamic.Interface, error)
+}
+
+// StaticCluster is a Cluster serving a fixed list of APIResources, with
+// their Group and Version set, through Client. The fake dynamic client of
+// client-go creates, gets, lists and deletes objects but can't patch or
+// server-side apply them, so updates need a fake that does.
+type StaticCluster struct {
+	Client       dynamic.Interface
+	APIResources []metav1.APIResource
+}
+
+// Resource implements Cluster.
+func (c StaticCluster) Resource(gvk schema.GroupVersionKind) (metav1.APIResource, error) {
+	for _, resource := range c.APIResources {
+		if resource.Group == gvk.Group && resource.Version == gvk.Version && resource.Kind == gvk.Kind {
+			return resource, nil
+		}
+	}
+	return metav1.APIResource{}, &NoResourceError{GroupVersionKind: gvk}
+}
+
+// Resources implements Cluster.
+func (c StaticCluster) Resources(groupVersion string) ([]metav1.APIResource, error) {
+	gv, err := schema.ParseGroupVersion(groupVersion)
+	if err != nil {
+		return nil, err
+	}
+	resources := []metav1.APIResource{}
+	for _, resource := range c.APIResources {
+		if resource.Group == gv.Group && resource.Version == gv.Version {
+			resources = append(resources, resource)
+		}
+	}
+	return resources, nil
+}
+
+// PreferredResources implements Cluster, every resource is preferred.
+func (c StaticCluster) PreferredResources() ([]metav1.APIResource, error) {
+	return append([]metav1.APIResource{}, c.APIResources...), nil
+}
+
+// Dynamic implements Cluster.
+func (c StaticCluster) Dynamic() (dynamic.Interface, error) {
+	return c.Client, nil
+}
+
+// restCluster is the Cluster of a config, discovering resources through the
+// discovery cache of the apply.
+type restCluster struct {
+	config *rest.Config
+	cache  *discoveryCache
+	logger Logger
+
+	once   sync.Once
+	client dynamic.Interface
+	err    error
+}
+
+func (c *restCluster) Resource(gvk schema.GroupVersionKind) (metav1.APIResource, error) {
+	return getAPIResourceForGVK(gvk, c.config, c.cache, c.logger)
+}
+
+func (c *restCluster) Resources(groupVersion string) ([]metav1.APIResource, error) {
+	list, ok := c.cache.get(groupVersion)
+	if !ok {
+		discoveryClient, err := discovery.NewDiscoveryClientForConfig(c.config)
+		if err != nil {
+			return nil, err
+		}
+		list, err = discoveryClient.ServerResourcesForGroupVersion(groupVersion)
+		if err != nil {
+			return nil, err
+		}
+		c.cache.set(groupVersion, list)
+	}
+	return withGroupVersion(list), nil
+}
+
+func (c *restCluster) PreferredResources() ([]metav1.APIResource, error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(c.config)
+	if err != nil {
+		return nil, err
+	}
+	lists, err := discoveryClient.ServerPreferredResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+	resources := []metav1.APIResource{}
+	for _, list := range lists {
+		resources = append(resources, withGroupVersion(list)...)
+	}
+	return resources, nil
+}
+
+// withGroupVersion returns the resources of list with the Group and Version
+// of list unless they are served from another one.
+func withGroupVersion(list *metav1.APIResourceList) []metav1.APIResource {
+	gv, err := schema.ParseGroupVersion(list.GroupVersion)
+	if err != nil {
+		return nil
+	}
+	resources := make([]metav1.APIResource, 0, len(list.APIResources))
+	for _, resource := range list.APIResources {
+		if resource.Group == "" && resource.Version == "" {
+			resource.Group = gv.Group
+			resource.Version = gv.Version
+		}
+		resources = append(resources, resource)
+	}
+	return resources
+}
+
+func (c *restCluster) Dynamic() (dynamic.Interface, error) {
+	c.once.Do(func() {
+		c.client, c.err = dynamic.NewForConfig(c.config)
+	})
+	return c.client, c.err
+}
+
+// namespaceableClient returns the client for the resource of gvk and whether
+// it is namespaced.
+func (a *applier) namespaceableClient(gvk schema.GroupVersionKind) (dynamic.NamespaceableResourceInterface, bool, error) {
+	resource, err := a.cluster.Resource(gvk)
+	if err != nil {
+		a.logf("[ERROR] unable to get apiresource from unstructured: %s , error %s", gvk.String(), err)
+		return nil, false, errors.Wrapf(err, "unable to get apiresource from unstructured: %s", gvk.String())
+	}
+	client, err := a.cluster.Dynamic()
+	if err != nil {
+		return nil, false, err
+	}
+	gvr := schema.GroupVersionResource{Group: gvk.Group, Version: gvk.Version, Resource: resource.Name}
+	return client.Resource(gvr), resource.Namespaced, nil
+}
@@ -0,0 +1,174 @@
+package kedge
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+var (
+	configMapResource  = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	deploymentResource = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+)
+
+// newTestCluster returns a StaticCluster serving namespaces, secrets,
+// configmaps and deployments from a fake dynamic client.
+func newTestCluster(objects ...runtime.Object) (StaticCluster, *fake.FakeDynamicClient) {
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		namespaceResource:  "NamespaceList",
+		secretResource:     "SecretList",
+		configMapResource:  "ConfigMapList",
+		deploymentResource: "DeploymentList",
+	}, objects...)
+	verbs := metav1.Verbs{"create", "get", "list", "delete"}
+	return StaticCluster{
+		Client: client,
+		APIResources: []metav1.APIResource{
+			{Version: "v1", Kind: "Namespace", Name: "namespaces", Verbs: verbs},
+			{Version: "v1", Kind: "Secret", Name: "secrets", Namespaced: true, Verbs: verbs},
+			{Version: "v1", Kind: "ConfigMap", Name: "configmaps", Namespaced: true, Verbs: verbs},
+			{Group: "apps", Version: "v1", Kind: "Deployment", Name: "deployments", Namespaced: true, Verbs: verbs},
+		},
+	}, client
+}
+
+// writeManifest writes content to a manifest file of a temporary directory.
+func writeManifest(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "manifest.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testBundle = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  level: "{{ .level }}"
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: 1
+`
+
+func TestStaticClusterApply(t *testing.T) {
+	cluster, client := newTestCluster()
+	values := writeManifest(t, "level: debug\n")
+	results, err := ApplyWithOptions(nil, writeManifest(t, testBundle), "team", []string{values}, Options{Cluster: cluster})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	for _, result := range results {
+		if result.Action != ActionCreated || result.Namespace != "team" {
+			t.Errorf("%s '%s': got %s in '%s', want created in 'team'", result.Kind, result.Name, result.Action, result.Namespace)
+		}
+	}
+
+	ctx := context.Background()
+	settings, err := client.Resource(configMapResource).Namespace("team").Get(ctx, "settings", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level := settings.Object["data"].(map[string]interface{})["level"]; level != "debug" {
+		t.Errorf("got level %v, want debug", level)
+	}
+	if _, err := client.Resource(deploymentResource).Namespace("team").Get(ctx, "app", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaticClusterDelete(t *testing.T) {
+	cluster, client := newTestCluster()
+	manifest := writeManifest(t, testBundle)
+	values := writeManifest(t, "level: debug\n")
+	opts := Options{Cluster: cluster}
+	if _, err := ApplyWithOptions(nil, manifest, "team", []string{values}, opts); err != nil {
+		t.Fatal(err)
+	}
+	results, err := DeleteWithOptions(nil, manifest, "team", []string{values}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Action != ActionDeleted {
+			t.Errorf("%s '%s': got %s, want deleted", result.Kind, result.Name, result.Action)
+		}
+	}
+	list, err := client.Resource(configMapResource).Namespace("team").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 0 {
+		t.Errorf("got %d configmaps left, want none", len(list.Items))
+	}
+}
+
+func TestStaticClusterCreateNamespace(t *testing.T) {
+	cluster, client := newTestCluster()
+	values := writeManifest(t, "level: debug\n")
+	opts := Options{
+		Cluster:         cluster,
+		CreateNamespace: &NamespaceMetadata{Labels: map[string]string{"team": "payments"}},
+	}
+	results, err := ApplyWithOptions(nil, writeManifest(t, testBundle), "team", []string{values}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Kind != "Namespace" || results[0].Action != ActionCreated {
+		t.Errorf("got %s %s first, want the Namespace created", results[0].Kind, results[0].Action)
+	}
+	ns, err := client.Resource(namespaceResource).Get(context.Background(), "team", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns.GetLabels()["team"] != "payments" {
+		t.Errorf("got labels %v, want team=payments", ns.GetLabels())
+	}
+}
+
+func TestStaticClusterUnknownKind(t *testing.T) {
+	cluster, _ := newTestCluster()
+	manifest := writeManifest(t, "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate\n")
+	_, err := ApplyWithOptions(nil, manifest, "team", nil, Options{Cluster: cluster})
+	var noResourceErr *NoResourceError
+	if !errors.As(err, &noResourceErr) {
+		t.Fatalf("got %v, want a NoResourceError", err)
+	}
+}
+
+func TestStaticClusterResources(t *testing.T) {
+	cluster, _ := newTestCluster()
+	tests := []struct {
+		groupVersion string
+		want         int
+	}{
+		{"v1", 3},
+		{"apps/v1", 1},
+		{"batch/v1", 0},
+	}
+	for _, tt := range tests {
+		resources, err := cluster.Resources(tt.groupVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resources) != tt.want {
+			t.Errorf("%s: got %d resources, want %d", tt.groupVersion, len(resources), tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package kedge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// maxConflictRetries bounds how many times OnConflict can ask to retry the
+// apply of a single object.
+const maxConflictRetries = 5
+
+// ConflictAction is how Options.OnConflict resolves a conflict.
+type ConflictAction string
+
+const (
+	// ConflictRetry applies the resolved object again, without forcing.
+	ConflictRetry ConflictAction = "retry"
+	// ConflictForce applies the resolved object taking ownership of the
+	// conflicting fields, like Options.ForceConflicts.
+	ConflictForce ConflictAction = "force"
+	// ConflictSkip leaves the object as is and carries on with the apply.
+	ConflictSkip ConflictAction = "skip"
+	// ConflictAbort fails the apply with the conflict.
+	ConflictAbort ConflictAction = "abort"
+)
+
+// ConflictFunc decides what to do when applying desired conflicts with the
+// live object. resolved is applied for ConflictRetry and ConflictForce,
+// desired is applied when it is nil.
+type ConflictFunc func(live, desired *unstructured.Unstructured) (resolved *unstructured.Unstructured, action ConflictAction, err error)
+
+// resolveConflict asks Options.OnConflict how to resolve conflictErr and
+// carries out its decision. It returns the object as stored by the server
+// and whether it was skipped.
+func (a *applier) resolveConflict(ctx context.Context, client dynamic.ResourceInterface, obj *unstructured.Unstructured, conflictErr *ConflictError) (*unstructured.Unstructured, bool, error) {
+	for i := 0; i < maxConflictRetries; i++ {
+		live, err := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return nil, false, fmt.Errorf("ERROR: could not get %s '%s/%s': %w", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+		}
+		resolved, action, err := a.opts.OnConflict(live, obj.DeepCopy())
+		if err != nil {
+			return nil, false, err
+		}
+		if resolved == nil {
+			resolved = obj
+		}
+		switch action {
+		case ConflictSkip:
+			return live, true, nil
+		case ConflictAbort:
+			return nil, false, conflictErr
+		case ConflictForce:
+			applied, err := a.serverSideApply(ctx, client, resolved, true)
+			return applied, false, err
+		case ConflictRetry:
+			applied, err := a.serverSideApply(ctx, client, resolved, false)
+			if !errors.As(err, &conflictErr) {
+				return applied, false, err
+			}
+		default:
+			return nil, false, fmt.Errorf("unknown conflict action %q", action)
+		}
+	}
+	return nil, false, fmt.Errorf("%s, still conflicting after %d retries", conflictErr, maxConflictRetries)
+}
@@ -0,0 +1,81 @@
+package kedge
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// defaultCRDTimeout is how long to wait for a CRD to be established when
+// Options.CRDTimeout is not set.
+const defaultCRDTimeout = time.Minute
+
+var crdResource = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// InstallOperator applies a manifest that ships CRDs along with resources
+// using them, eg an operator and a sample custom resource. Objects are applied
+// in install order and every CRD has to be established before the rest of the
+// manifest is applied. It takes the same inputs as Apply.
+func InstallOperator(config *rest.Config, inputFilename, namespace string, valueFilenames []string) error {
+	_, err := ApplyWithOptions(config, inputFilename, namespace, valueFilenames, Options{
+		InstallOrder: true,
+		WaitForCRDs:  true,
+	})
+	return err
+}
+
+// WaitForCRD blocks until the CustomResourceDefinition is established, which
+// means its custom resources can be created.
+func WaitForCRD(config *rest.Config, name string, timeout time.Duration) error {
+	return WaitForCRDContext(context.Background(), config, name, timeout)
+}
+
+// WaitForCRDContext is WaitForCRD returning early with ctx.Err() when ctx is
+// done.
+func WaitForCRDContext(ctx context.Context, config *rest.Config, name string, timeout time.Duration) error {
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	return waitForCRD(ctx, client, name, timeout)
+}
+
+func waitForCRD(ctx context.Context, client dynamic.Interface, name string, timeout time.Duration) error {
+	err := poll(ctx, timeout, func(ctx context.Context) (bool, error) {
+		crd, err := client.Resource(crdResource).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return hasCondition(crd, "Established", "True"), nil
+	})
+	if err != nil {
+		return fmt.Errorf("CustomResourceDefinition '%s' is not established: %s", name, err)
+	}
+	return nil
+}
+
+// hasCondition reports whether obj has a status condition of conditionType
+// with the given status.
+func hasCondition(obj *unstructured.Unstructured, conditionType, status string) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if condition["type"] == conditionType && condition["status"] == status {
+			return true
+		}
+	}
+	return false
+}
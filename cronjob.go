@@ -0,0 +1,88 @@
+package kedge
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// suspendCronJob sets spec.suspend on a CronJob that's about to be applied
+// and remembers whether the manifest wants it suspended for good. obj is kept
+// as it is applied so it can be applied again, resumed, with server-side
+// apply.
+func (a *applier) suspendCronJob(obj *unstructured.Unstructured) error {
+	suspend, _, _ := unstructured.NestedBool(obj.Object, "spec", "suspend")
+	if !suspend {
+		if a.resume == nil {
+			a.resume = map[string]*unstructured.Unstructured{}
+		}
+		a.resume[objectKey(obj.GetKind(), obj.GetNamespace(), obj.GetName())] = obj
+	}
+	return unstructured.SetNestedField(obj.Object, true, "spec", "suspend")
+}
+
+// resumeCronJobs unsuspends the CronJobs suspended by suspendCronJob once
+// the whole manifest has been applied, under the field manager of the apply
+// so the next apply owns spec.suspend alone.
+func (a *applier) resumeCronJobs() error {
+	ctx := a.context()
+	for i, result := range a.results {
+		obj, ok := a.resume[objectKey(result.Kind, result.Namespace, result.Name)]
+		if result.Kind != "CronJob" || !ok {
+			continue
+		}
+		client, err := a.clientForResult(result)
+		if err != nil {
+			return err
+		}
+		var live *unstructured.Unstructured
+		if a.opts.ServerSideApply && !a.opts.SkipIfExists && obj.GetName() != "" {
+			// an apply of spec.suspend alone would give up the other
+			// fields, the whole object is applied again
+			resumed := obj.DeepCopy()
+			if err := unstructured.SetNestedField(resumed.Object, false, "spec", "suspend"); err != nil {
+				return err
+			}
+			live, err = a.serverSideApply(ctx, client, resumed, a.opts.ForceConflicts)
+		} else {
+			patch := []byte(`{"spec":{"suspend":false}}`)
+			live, err = client.Patch(ctx, result.Name, types.MergePatchType, patch, metav1.PatchOptions{
+				FieldManager: a.opts.fieldManager(result.Kind),
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("ERROR: could not resume %s '%s/%s': %s", result.Kind, result.Namespace, result.Name, err)
+		}
+		a.logf("%s '%s/%s' has been resumed", result.Kind, result.Namespace, result.Name)
+		a.results[i].NextSchedule = nextSchedule(live)
+	}
+	return nil
+}
+
+// nextSchedule returns when a CronJob runs next, or nil if it is suspended
+// or its schedule can't be parsed.
+func nextSchedule(obj *unstructured.Unstructured) *time.Time {
+	suspend, _, _ := unstructured.NestedBool(obj.Object, "spec", "suspend")
+	if suspend {
+		return nil
+	}
+	schedule, _, _ := unstructured.NestedString(obj.Object, "spec", "schedule")
+	location := time.Local
+	if tz, found, _ := unstructured.NestedString(obj.Object, "spec", "timeZone"); found && tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil
+		}
+		location = loc
+	}
+	sched, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return nil
+	}
+	next := sched.Next(time.Now().In(location))
+	return &next
+}
@@ -0,0 +1,109 @@
+package kedge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var cronJobResource = schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "cronjobs"}
+
+// suspendManagers is a dynamic client tracking the field manager of the
+// spec.suspend of objects, like the API server does. Server-side applies of
+// spec.suspend by another manager conflict unless forced.
+type suspendManagers struct {
+	dynamic.Interface
+	owners map[string]string
+}
+
+func (c *suspendManagers) Resource(resource schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return suspendResource{NamespaceableResourceInterface: c.Interface.Resource(resource), owners: c.owners}
+}
+
+type suspendResource struct {
+	dynamic.NamespaceableResourceInterface
+	owners    map[string]string
+	namespace string
+}
+
+func (r suspendResource) Namespace(namespace string) dynamic.ResourceInterface {
+	r.namespace = namespace
+	return r
+}
+
+func (r suspendResource) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	patch := map[string]interface{}{}
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return nil, err
+	}
+	manager := opts.FieldManager
+	if manager == "" {
+		// the server names the manager after the user agent
+		manager = "kedge/dev"
+	}
+	key := r.namespace + "/" + name
+	if _, found, _ := unstructured.NestedBool(patch, "spec", "suspend"); found {
+		owner := r.owners[key]
+		force := opts.Force != nil && *opts.Force
+		if pt == types.ApplyPatchType && owner != "" && owner != manager && !force {
+			return nil, kerrors.NewConflict(cronJobResource.GroupResource(), name, fmt.Errorf("spec.suspend is managed by %s", owner))
+		}
+		r.owners[key] = manager
+	}
+	var client dynamic.ResourceInterface = r.NamespaceableResourceInterface
+	if r.namespace != "" {
+		client = r.NamespaceableResourceInterface.Namespace(r.namespace)
+	}
+	return client.Patch(ctx, name, pt, data, opts, subresources...)
+}
+
+func TestResumeCronJobsServerSideApply(t *testing.T) {
+	cluster, client := newTestCluster()
+	cluster.APIResources = append(cluster.APIResources, metav1.APIResource{Group: "batch", Version: "v1", Kind: "CronJob", Name: "cronjobs", Namespaced: true, Verbs: metav1.Verbs{"create", "get", "patch"}})
+	// the fake stores server-side applies as they are sent, merge patches
+	// are applied by the fake
+	client.PrependReactor("patch", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(patch.GetPatch()); err != nil {
+			return true, nil, err
+		}
+		tracker := client.Tracker()
+		if _, err := tracker.Get(cronJobResource, patch.GetNamespace(), patch.GetName()); kerrors.IsNotFound(err) {
+			return true, obj, tracker.Create(cronJobResource, obj, patch.GetNamespace())
+		}
+		return true, obj, tracker.Update(cronJobResource, obj, patch.GetNamespace())
+	})
+	cluster.Client = &suspendManagers{Interface: client, owners: map[string]string{}}
+
+	manifest := writeManifest(t, "apiVersion: batch/v1\nkind: CronJob\nmetadata:\n  name: report\nspec:\n  schedule: \"0 * * * *\"\n")
+	opts := Options{Cluster: cluster, ServerSideApply: true, SuspendCronJobs: true}
+	for i := 1; i <= 2; i++ {
+		if _, err := ApplyWithOptions(nil, manifest, "team", nil, opts); err != nil {
+			t.Fatalf("apply %d: %s", i, err)
+		}
+		live, err := client.Resource(cronJobResource).Namespace("team").Get(context.Background(), "report", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if suspend, _, _ := unstructured.NestedBool(live.Object, "spec", "suspend"); suspend {
+			t.Errorf("apply %d: got the CronJob suspended, want it resumed", i)
+		}
+		if schedule, _, _ := unstructured.NestedString(live.Object, "spec", "schedule"); schedule != "0 * * * *" {
+			t.Errorf("apply %d: got schedule %q, want the resume to keep it", i, schedule)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package kedge
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ghodss/yaml"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+)
+
+// Delete renders the manifest the same way Apply does and deletes every
+// object in it. Objects that are already gone are skipped.
+func Delete(config *rest.Config, inputFilename, namespace string, valueFilenames []string) error {
+	_, err := DeleteWithOptions(config, inputFilename, namespace, valueFilenames, Options{})
+	return err
+}
+
+// DeleteWithOptions is Delete using opts, eg to choose the propagation policy
+// or, with InstallOrder, to delete a Namespace after the objects in it.
+func DeleteWithOptions(config *rest.Config, inputFilename, namespace string, valueFilenames []string, opts Options) ([]Result, error) {
+	opts.liveConfig = config
+	b, namespace, err := renderManifest(inputFilename, namespace, valueFilenames, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	a := newApplier(config, opts)
+	docs := splitDocuments(b)
+	if opts.InstallOrder {
+		sortByUninstallOrder(docs)
+	}
+	for _, doc := range docs {
+		if err := a.deleteResource(doc, namespace); err != nil {
+			return a.results, a.explainError(err)
+		}
+	}
+	return a.results, nil
+}
+
+func (a *applier) deleteResource(b []byte, namespace string) error {
+	ctx := a.context()
+
+	obj := unstructured.Unstructured{}
+	err := yaml.Unmarshal(b, &obj)
+	if err != nil {
+		return fmt.Errorf("ERROR: could not unmarshal resource: %s", err)
+	}
+
+	if obj.IsList() {
+		return obj.EachListItem(func(item runtime.Object) error {
+			b, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			return a.deleteResource(b, namespace)
+		})
+	}
+
+	gvk := obj.GroupVersionKind()
+	if gvk.Kind == "List" {
+		return nil
+	}
+	if err := a.checkGroup(gvk, obj.GetName()); err != nil {
+		return err
+	}
+
+	dynamicClient, namespace, err := a.resourceClient(&obj, namespace)
+	if err != nil {
+		return err
+	}
+	unnamed, err := a.unnamed(ctx, dynamicClient, &obj, namespace)
+	if err != nil {
+		return err
+	}
+	result := Result{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       gvk.Kind,
+		Namespace:  namespace,
+		Name:       obj.GetName(),
+	}
+	if unnamed {
+		// without Options.TrackGenerateName there is no telling which
+		// object a previous apply created
+		a.logf("[WARN] skipping %s '%s/%s*': the server generates its name, there is no object to delete", gvk.Kind, namespace, obj.GetGenerateName())
+		result.Action = ActionSkipped
+		return a.record(result)
+	}
+
+	err = dynamicClient.Delete(ctx, obj.GetName(), a.opts.deleteOptions())
+	if err != nil {
+		if !kerrors.IsNotFound(err) {
+			return fmt.Errorf("ERROR: could not delete %s '%s/%s': %w", gvk.Kind, namespace, obj.GetName(), err)
+		}
+		a.logf("%s '%s/%s' does not exist", gvk.Kind, namespace, obj.GetName())
+		result.Action = ActionUnchanged
+	} else {
+		a.logf("%s '%s/%s' has been deleted", gvk.Kind, namespace, obj.GetName())
+		result.Action = ActionDeleted
+	}
+	return a.record(result)
+}
@@ -0,0 +1,129 @@
+package kedge
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// namespaceBundle holds its own Namespace, listed after what goes in it.
+const namespaceBundle = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: team
+spec:
+  replicas: 1
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: team
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: team
+`
+
+func TestInstallOrderNamespaceBundle(t *testing.T) {
+	cluster, client := newTestCluster()
+	var order []string
+	record := func(action k8stesting.Action) (bool, runtime.Object, error) {
+		order = append(order, action.GetVerb()+" "+action.GetResource().Resource)
+		return false, nil, nil
+	}
+	client.PrependReactor("create", "*", record)
+	client.PrependReactor("delete", "*", record)
+	manifest := writeManifest(t, namespaceBundle)
+	opts := Options{Cluster: cluster, InstallOrder: true}
+
+	if _, err := ApplyWithOptions(nil, manifest, "", nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"create namespaces", "create configmaps", "create deployments"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("apply: got %v, want %v", order, want)
+	}
+
+	order = nil
+	results, err := DeleteWithOptions(nil, manifest, "", nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"delete deployments", "delete configmaps", "delete namespaces"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("delete: got %v, want %v", order, want)
+	}
+	for _, result := range results {
+		if result.Action != ActionDeleted {
+			t.Errorf("%s '%s': got %s, want deleted", result.Kind, result.Name, result.Action)
+		}
+	}
+	if _, err := client.Resource(namespaceResource).Get(context.Background(), "team", metav1.GetOptions{}); err == nil {
+		t.Error("got the Namespace, want it deleted")
+	}
+}
+
+const generatedManifest = "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  generateName: settings-\n"
+
+func TestDeleteGenerateName(t *testing.T) {
+	cluster, client := newTestCluster()
+	results, err := DeleteWithOptions(nil, writeManifest(t, generatedManifest), "team", nil, Options{Cluster: cluster})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Action != ActionSkipped {
+		t.Fatalf("got %v, want the ConfigMap skipped", results)
+	}
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "delete" {
+			t.Errorf("got a delete of %s, want none for a generateName object", action.GetResource().Resource)
+		}
+	}
+}
+
+func TestDeleteTrackedGenerateName(t *testing.T) {
+	generated := &unstructured.Unstructured{}
+	generated.SetAPIVersion("v1")
+	generated.SetKind("ConfigMap")
+	generated.SetGenerateName("settings-")
+	generated.SetNamespace("team")
+	generated.SetName("settings-x7k2p")
+	generated.SetLabels(map[string]string{generateIDLabel: generateID(generated, "team")})
+	cluster, client := newTestCluster(generated)
+
+	opts := Options{Cluster: cluster, TrackGenerateName: true}
+	results, err := DeleteWithOptions(nil, writeManifest(t, generatedManifest), "team", nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Action != ActionDeleted || results[0].Name != "settings-x7k2p" {
+		t.Fatalf("got %v, want 'settings-x7k2p' deleted", results)
+	}
+	if _, err := client.Resource(configMapResource).Namespace("team").Get(context.Background(), "settings-x7k2p", metav1.GetOptions{}); err == nil {
+		t.Error("got 'settings-x7k2p', want it deleted")
+	}
+}
+
+func TestDeleteAllowedGroups(t *testing.T) {
+	cluster, client := newTestCluster()
+	manifest := writeManifest(t, testBundle)
+	values := writeManifest(t, "level: debug\n")
+	if _, err := ApplyWithOptions(nil, manifest, "team", []string{values}, Options{Cluster: cluster}); err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Cluster: cluster, AllowedGroups: []string{""}}
+	if _, err := DeleteWithOptions(nil, manifest, "team", []string{values}, opts); err == nil {
+		t.Fatal("got no error, want the Deployment rejected")
+	}
+	if _, err := client.Resource(deploymentResource).Namespace("team").Get(context.Background(), "app", metav1.GetOptions{}); err != nil {
+		t.Errorf("got %v, want the Deployment kept", err)
+	}
+}
@@ -0,0 +1,177 @@
+package kedge
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// maxDiscoveryPrefetch bounds how many group versions prefetchDiscovery
+// discovers at once.
+const maxDiscoveryPrefetch = 8
+
+// defaultDiscoveryCacheTTL is how long lists cached on disk are used for
+// when Options.DiscoveryCacheTTL isn't set.
+const defaultDiscoveryCacheTTL = 10 * time.Minute
+
+// discoveryCache holds the API resource lists discovered during a single
+// apply, by group version. With a dir they are also kept on disk, for ttl,
+// so later processes don't have to discover them again.
+type discoveryCache struct {
+	mu     sync.Mutex
+	lists  map[string]*metav1.APIResourceList
+	dir    string
+	ttl    time.Duration
+	logger Logger
+}
+
+// newDiscoveryCache returns the cache of an apply to the cluster of config.
+// Lists are cached on disk under opts.DiscoveryCacheDir, by API server.
+func newDiscoveryCache(config *rest.Config, opts Options) *discoveryCache {
+	c := &discoveryCache{ttl: opts.DiscoveryCacheTTL, logger: opts.logger()}
+	if c.ttl <= 0 {
+		c.ttl = defaultDiscoveryCacheTTL
+	}
+	if opts.DiscoveryCacheDir != "" {
+		c.dir = filepath.Join(opts.DiscoveryCacheDir, cacheDirName(config.Host))
+	}
+	return c
+}
+
+func (c *discoveryCache) get(groupVersion string) (*metav1.APIResourceList, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if list, ok := c.lists[groupVersion]; ok {
+		return list, true
+	}
+	list, ok := c.read(groupVersion)
+	if ok {
+		c.remember(groupVersion, list)
+	}
+	return list, ok
+}
+
+func (c *discoveryCache) set(groupVersion string, list *metav1.APIResourceList) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remember(groupVersion, list)
+	c.write(groupVersion, list)
+}
+
+// invalidate forgets the list of groupVersion, on disk too.
+func (c *discoveryCache) invalidate(groupVersion string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.lists, groupVersion)
+	if c.dir != "" {
+		os.Remove(c.file(groupVersion))
+	}
+}
+
+func (c *discoveryCache) remember(groupVersion string, list *metav1.APIResourceList) {
+	if c.lists == nil {
+		c.lists = map[string]*metav1.APIResourceList{}
+	}
+	c.lists[groupVersion] = list
+}
+
+// read returns the list of groupVersion cached on disk, unless it is older
+// than the ttl. A cache that can't be read is a miss.
+func (c *discoveryCache) read(groupVersion string) (*metav1.APIResourceList, bool) {
+	if c.dir == "" {
+		return nil, false
+	}
+	f := c.file(groupVersion)
+	info, err := os.Stat(f)
+	if err != nil || time.Since(info.ModTime()) > c.ttl {
+		return nil, false
+	}
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, false
+	}
+	list := &metav1.APIResourceList{}
+	if err := json.Unmarshal(b, list); err != nil {
+		return nil, false
+	}
+	return list, true
+}
+
+// write caches list on disk. Failing to is only logged, discovery still
+// works without the cache.
+func (c *discoveryCache) write(groupVersion string, list *metav1.APIResourceList) {
+	if c.dir == "" {
+		return
+	}
+	b, err := json.Marshal(list)
+	if err == nil {
+		err = os.MkdirAll(c.dir, 0o755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(c.file(groupVersion), b, 0o644)
+	}
+	if err != nil {
+		c.logger.Printf("[WARN] could not cache the discovery of %s: %s", groupVersion, err)
+	}
+}
+
+func (c *discoveryCache) file(groupVersion string) string {
+	return filepath.Join(c.dir, cacheDirName(groupVersion)+".json")
+}
+
+// cacheDirName turns an API server URL or group version into a file name.
+func cacheDirName(s string) string {
+	return strings.NewReplacer("https://", "", "http://", "", "/", "_", ":", "_").Replace(s)
+}
+
+// prefetchDiscovery discovers the group versions of every object in docs
+// concurrently so applying them doesn't wait on discovery one group version
+// at a time. Failures are left for the apply of the object to report.
+func (a *applier) prefetchDiscovery(docs [][]byte) {
+	groupVersions := map[string]bool{}
+	for _, doc := range docs {
+		objs, err := decodeObjects(doc)
+		if err != nil {
+			continue
+		}
+		for _, obj := range objs {
+			groupVersions[obj.GetAPIVersion()] = true
+		}
+	}
+	if len(groupVersions) < 2 {
+		return
+	}
+
+	sem := make(chan struct{}, maxDiscoveryPrefetch)
+	var wg sync.WaitGroup
+	for groupVersion := range groupVersions {
+		if _, ok := a.discovery.get(groupVersion); ok {
+			continue
+		}
+		wg.Add(1)
+		go func(groupVersion string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			// a restCluster caches what it discovers
+			a.cluster.Resources(groupVersion)
+		}(groupVersion)
+	}
+	wg.Wait()
+}
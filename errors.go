@@ -0,0 +1,169 @@
+package kedge
+
+import (
+	"fmt"
+	"strings"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// FieldConflict is a single field owned by another manager that prevented a
+// server-side apply.
+type FieldConflict struct {
+	// Field is the path of the conflicting field, eg ".spec.replicas"
+	Field string
+	// Manager is the field manager that currently owns Field
+	Manager string
+	// Message is the raw conflict message returned by the API server
+	Message string
+}
+
+// ConflictError is returned when a server-side apply is rejected because
+// fields of the object are owned by other field managers. Use
+// errors.As to inspect the conflicts and decide whether to force the apply
+// with Options.ForceConflicts.
+type ConflictError struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Conflicts []FieldConflict
+	err       error
+}
+
+func (e *ConflictError) Error() string {
+	fields := make([]string, 0, len(e.Conflicts))
+	for _, c := range e.Conflicts {
+		fields = append(fields, fmt.Sprintf("%s (owned by %q)", c.Field, c.Manager))
+	}
+	return fmt.Sprintf("%s '%s/%s' has %d field conflict(s): %s", e.Kind, e.Namespace, e.Name, len(e.Conflicts), strings.Join(fields, ", "))
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.err
+}
+
+// newConflictError extracts the field manager conflicts from a server-side
+// apply error. nil is returned if err does not carry any conflicts.
+func newConflictError(err error, kind, namespace, name string) *ConflictError {
+	if !kerrors.IsConflict(err) {
+		return nil
+	}
+	status, ok := err.(kerrors.APIStatus)
+	if !ok || status.Status().Details == nil {
+		return nil
+	}
+	conflicts := []FieldConflict{}
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+		conflicts = append(conflicts, FieldConflict{
+			Field:   cause.Field,
+			Manager: conflictManager(cause.Message),
+			Message: cause.Message,
+		})
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return &ConflictError{
+		Kind:      kind,
+		Namespace: namespace,
+		Name:      name,
+		Conflicts: conflicts,
+		err:       err,
+	}
+}
+
+// conflictManager parses the manager out of a conflict message which the API
+// server formats as `conflict with "manager" using apps/v1`.
+func conflictManager(message string) string {
+	start := strings.Index(message, `"`)
+	if start < 0 {
+		return ""
+	}
+	end := strings.Index(message[start+1:], `"`)
+	if end < 0 {
+		return ""
+	}
+	return message[start+1 : start+1+end]
+}
+
+// NoResourceError is returned when the cluster does not serve the kind of an
+// object under its apiVersion. Available lists the group versions the kind
+// is served under instead, if any, which usually means the manifest uses a
+// deprecated or removed apiVersion.
+type NoResourceError struct {
+	GroupVersionKind schema.GroupVersionKind
+	Available        []string
+}
+
+func (e *NoResourceError) Error() string {
+	gv := e.GroupVersionKind.GroupVersion().String()
+	if len(e.Available) == 0 {
+		if scheme.Scheme.IsGroupRegistered(e.GroupVersionKind.Group) {
+			return fmt.Sprintf("no API resource found for kind %s in %s", e.GroupVersionKind.Kind, gv)
+		}
+		return fmt.Sprintf("kind %s (%s) is not installed on the cluster; is its CRD applied?", e.GroupVersionKind.Kind, gv)
+	}
+	return fmt.Sprintf("kind %s is not served as %s, the cluster serves it as %s; update the apiVersion of the manifest", e.GroupVersionKind.Kind, gv, strings.Join(e.Available, ", "))
+}
+
+// newNoResourceError looks through discovery for other group versions
+// serving the kind of gvk. Group versions in the same API group are listed
+// first since they are the most likely replacement.
+func newNoResourceError(gvk schema.GroupVersionKind, discoveryClient discovery.DiscoveryInterface, logger Logger) *NoResourceError {
+	e := &NoResourceError{GroupVersionKind: gvk}
+	_, resLists, err := discoveryClient.ServerGroupsAndResources()
+	if err != nil {
+		// Aggregated API servers (eg metrics.k8s.io) that are down make
+		// discovery fail for their group only. The other groups are still
+		// returned and are good enough to look for the kind.
+		if !discovery.IsGroupDiscoveryFailedError(err) {
+			return e
+		}
+		for gv, groupErr := range err.(*discovery.ErrGroupDiscoveryFailed).Groups {
+			logger.Printf("[WARN] ignoring unavailable group version %s: %s", gv.String(), groupErr)
+		}
+	}
+	other := []string{}
+	for _, resList := range resLists {
+		for _, resource := range resList.APIResources {
+			if resource.Kind != gvk.Kind || strings.Contains(resource.Name, "/") {
+				continue
+			}
+			gv, err := schema.ParseGroupVersion(resList.GroupVersion)
+			if err != nil {
+				continue
+			}
+			if gv.Group == gvk.Group {
+				e.Available = append(e.Available, resList.GroupVersion)
+			} else {
+				other = append(other, resList.GroupVersion)
+			}
+			break
+		}
+	}
+	e.Available = append(e.Available, other...)
+	return e
+}
+
+// isMissingResource reports whether err is the NotFound of the resource
+// endpoint itself, "the server could not find the requested resource", as
+// opposed to a missing object or namespace. It happens when discovery still
+// lists a CRD that has since been removed.
+func isMissingResource(err error) bool {
+	if !kerrors.IsNotFound(err) {
+		return false
+	}
+	status, ok := err.(kerrors.APIStatus)
+	if !ok {
+		return false
+	}
+	details := status.Status().Details
+	return details == nil || details.Name == ""
+}
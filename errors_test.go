@@ -0,0 +1,26 @@
+package kedge
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestNewNoResourceErrorAvailable(t *testing.T) {
+	ingress := []metav1.APIResource{{Kind: "Ingress", Name: "ingresses"}, {Kind: "Ingress", Name: "ingresses/status"}}
+	discoveryClient := &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{Resources: []*metav1.APIResourceList{
+		{GroupVersion: "networking.k8s.io/v1", APIResources: ingress},
+		{GroupVersion: "extensions/v1beta2", APIResources: ingress},
+		{GroupVersion: "v1", APIResources: []metav1.APIResource{{Kind: "ConfigMap", Name: "configmaps"}}},
+		{GroupVersion: "extensions/v1beta3", APIResources: ingress},
+	}}}
+	e := newNoResourceError(schema.GroupVersionKind{Group: "extensions", Version: "v1beta1", Kind: "Ingress"}, discoveryClient, stdLogger{})
+	want := []string{"extensions/v1beta2", "extensions/v1beta3", "networking.k8s.io/v1"}
+	if !reflect.DeepEqual(e.Available, want) {
+		t.Errorf("got %v, want the same group first: %v", e.Available, want)
+	}
+}
@@ -0,0 +1,81 @@
+package kedge
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// exportResults writes the applied objects, as the server stores them, to
+// Options.ExportFile as a multi document YAML manifest.
+func (a *applier) exportResults() error {
+	ctx := a.context()
+	var manifest bytes.Buffer
+	exported := map[string]bool{}
+	for _, result := range a.results {
+		key := objectKey(result.Kind, result.Namespace, result.Name)
+		if result.Action == ActionDeleted || result.Action == ActionSkipped || exported[key] {
+			continue
+		}
+		exported[key] = true
+		client, err := a.clientForResult(result)
+		if err != nil {
+			return err
+		}
+		live, err := client.Get(ctx, result.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("ERROR: could not get %s '%s/%s': %w", result.Kind, result.Namespace, result.Name, err)
+		}
+		b, err := yaml.Marshal(exportable(live).Object)
+		if err != nil {
+			return fmt.Errorf("could not marshal resource '%s/%s': %s", result.Namespace, result.Name, err)
+		}
+		manifest.WriteString("---\n")
+		manifest.Write(b)
+	}
+	if err := writePrivateFile(a.opts.ExportFile, manifest.Bytes()); err != nil {
+		return fmt.Errorf("could not write %s: %s", a.opts.ExportFile, err)
+	}
+	return nil
+}
+
+// writePrivateFile replaces the file at path with b, readable by its owner
+// only since it may hold Secrets. The content is written to a temporary file
+// which is renamed over path, so readers never see a partial file and an
+// existing file of another mode is replaced rather than written in place.
+func writePrivateFile(path string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// exportable returns live without the fields set by the server and the
+// annotations kedge keeps to compare applies, so it can be applied as is.
+func exportable(live *unstructured.Unstructured) *unstructured.Unstructured {
+	obj := withoutServerFields(live)
+	annotations := obj.GetAnnotations()
+	delete(annotations, hashAnnotation)
+	delete(annotations, lastAppliedAnnotation)
+	if len(annotations) == 0 {
+		unstructured.RemoveNestedField(obj.Object, "metadata", "annotations")
+	} else {
+		obj.SetAnnotations(annotations)
+	}
+	return obj
+}
@@ -0,0 +1,42 @@
+package kedge
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportFileMode(t *testing.T) {
+	cluster, _ := newTestCluster()
+	export := filepath.Join(t.TempDir(), "export.yaml")
+	// an export left by an older version, readable by everyone
+	if err := os.WriteFile(export, []byte("---\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Cluster: cluster, ExportFile: export}
+	if _, err := ApplyWithOptions(nil, writeManifest(t, settingsManifest), "team", nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("got mode %o, want 600", mode)
+	}
+	b, err := os.ReadFile(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "name: settings") {
+		t.Errorf("got\n%s\nwant the ConfigMap exported", b)
+	}
+	entries, err := os.ReadDir(filepath.Dir(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files, want the temporary file removed", len(entries))
+	}
+}
@@ -0,0 +1,126 @@
+package kedge
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// Files gives templates access to files relative to the template directory.
+// It is exposed to templates as .Files and mirrors Helm's .Files object, eg
+//
+//	data:
+//	{{ (.Files.Glob "config/*.ini").AsConfig | indent 2 }}
+type Files struct {
+	baseDir string
+	// names restricts the set of files after a Glob. nil means any file under
+	// baseDir can be read.
+	names []string
+}
+
+func newFiles(baseDir string) Files {
+	return Files{baseDir: baseDir}
+}
+
+// Get returns the content of the file at name, relative to the template
+// directory.
+func (f Files) Get(name string) (string, error) {
+	b, err := f.GetBytes(name)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// GetBytes returns the content of the file at name as a byte slice.
+func (f Files) GetBytes(name string) ([]byte, error) {
+	path, err := f.path(name)
+	if err != nil {
+		return nil, err
+	}
+	if f.names != nil && !contains(f.names, name) {
+		return nil, fmt.Errorf("file '%s' is not in the selected set of files", name)
+	}
+	return ioutil.ReadFile(path)
+}
+
+// Glob returns the set of files matching pattern, relative to the template
+// directory. The result can be further converted with AsConfig or AsSecrets.
+func (f Files) Glob(pattern string) (Files, error) {
+	matches, err := filepath.Glob(filepath.Join(f.baseDir, pattern))
+	if err != nil {
+		return Files{}, err
+	}
+	names := []string{}
+	for _, match := range matches {
+		name, err := filepath.Rel(f.baseDir, match)
+		if err != nil {
+			return Files{}, err
+		}
+		if f.names != nil && !contains(f.names, name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return Files{baseDir: f.baseDir, names: names}, nil
+}
+
+// AsConfig returns the selected files as a YAML map of base filename to
+// content, suitable for the data field of a ConfigMap.
+func (f Files) AsConfig() (string, error) {
+	return f.asMap(func(b []byte) string { return string(b) })
+}
+
+// AsSecrets returns the selected files as a YAML map of base filename to
+// base64 encoded content, suitable for the data field of a Secret.
+func (f Files) AsSecrets() (string, error) {
+	return f.asMap(base64.StdEncoding.EncodeToString)
+}
+
+func (f Files) asMap(encode func([]byte) string) (string, error) {
+	if f.names == nil {
+		return "", fmt.Errorf("select files with Glob before converting them")
+	}
+	m := make(map[string]string, len(f.names))
+	for _, name := range f.names {
+		b, err := f.GetBytes(name)
+		if err != nil {
+			return "", err
+		}
+		m[filepath.Base(name)] = encode(b)
+	}
+	if len(m) == 0 {
+		return "", nil
+	}
+	b, err := yaml.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
+
+// path resolves name against the template directory and refuses to read
+// anything outside of it.
+func (f Files) path(name string) (string, error) {
+	path := filepath.Join(f.baseDir, name)
+	rel, err := filepath.Rel(f.baseDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file '%s' is outside of the template directory", name)
+	}
+	return path, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package kedge
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// SecretResolver looks up secret values while a template is rendered so they
+// don't have to be stored in values files. Implementations typically wrap a
+// secret manager.
+type SecretResolver interface {
+	ResolveSecret(key string) (string, error)
+}
+
+// ExternalResolver looks up values in an external store, like a secret
+// manager, while a template is rendered. Resolvers are registered per scheme
+// in Options.ExternalResolvers, eg "vault" or "aws-sm".
+type ExternalResolver interface {
+	// Resolve returns the value of key at path, eg the "password" key of
+	// "secret/data/app".
+	Resolve(path, key string) (string, error)
+}
+
+// resolverFuncName matches schemes usable as template function names.
+var resolverFuncName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// resolveExternal resolves path and key with the ExternalResolver of scheme.
+func resolveExternal(opts Options, scheme, path, key string) (string, error) {
+	resolver, ok := opts.ExternalResolvers[scheme]
+	if !ok || resolver == nil {
+		return "", fmt.Errorf("cannot resolve %q of %s %q: no ExternalResolver is configured for %q", key, scheme, path, scheme)
+	}
+	value, err := resolver.Resolve(path, key)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve %q of %s %q: %w", key, scheme, path, err)
+	}
+	return value, nil
+}
+
+// templateFuncs returns the kedge specific template functions configured by
+// opts.
+func templateFuncs(opts Options) template.FuncMap {
+	if opts.shared == nil {
+		opts.shared = newSharedValues()
+		opts.shared.final = true
+	}
+	funcs := template.FuncMap{}
+	for scheme := range opts.ExternalResolvers {
+		if !resolverFuncName.MatchString(scheme) {
+			continue
+		}
+		scheme := scheme
+		funcs[scheme] = func(path, key string) (string, error) {
+			return resolveExternal(opts, scheme, path, key)
+		}
+	}
+	for name, f := range builtinFuncs(opts) {
+		funcs[name] = f
+	}
+	return funcs
+}
+
+// builtinFuncs are the template functions that are always defined. They take
+// precedence over functions of ExternalResolvers schemes.
+func builtinFuncs(opts Options) template.FuncMap {
+	return template.FuncMap{
+		"secret": func(key string) (string, error) {
+			if opts.SecretResolver == nil {
+				return "", fmt.Errorf("cannot resolve secret %q: no SecretResolver is configured", key)
+			}
+			return opts.SecretResolver.ResolveSecret(key)
+		},
+		// vault is always defined so templates using it fail with a clear
+		// error when no resolver is configured
+		"vault": func(path, key string) (string, error) {
+			return resolveExternal(opts, "vault", path, key)
+		},
+		"external": func(scheme, path, key string) (string, error) {
+			return resolveExternal(opts, scheme, path, key)
+		},
+		"share":  opts.shared.share,
+		"shared": opts.shared.get,
+		"toYaml": toYAML,
+		"countResources": func(apiVersion, kind, selector string) (int, error) {
+			return countResources(opts, apiVersion, kind, selector)
+		},
+		"stableRandAlphaNum": func(key string, length int) (string, error) {
+			if opts.RandomSeed == "" {
+				return "", fmt.Errorf("cannot generate a stable value for %q: no RandomSeed is configured", key)
+			}
+			return stableRandAlphaNum(opts.RandomSeed, key, length), nil
+		},
+		"required": func(message string, v interface{}) (interface{}, error) {
+			if v == nil {
+				return nil, fmt.Errorf("%s", message)
+			}
+			if s, ok := v.(string); ok && s == "" {
+				return nil, fmt.Errorf("%s", message)
+			}
+			return v, nil
+		},
+	}
+}
+
+// toYAML serializes v as YAML without the trailing newline, like Helm's
+// toYaml.
+func toYAML(v interface{}) (string, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
+
+const alphaNum = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// stableRandAlphaNum returns length random looking alphanumeric characters
+// that only depend on seed and key, from a HMAC-SHA256 of key keyed by
+// seed. Bytes are rejected rather than wrapped around so every character is
+// equally likely.
+func stableRandAlphaNum(seed, key string, length int) string {
+	out := make([]byte, 0, length)
+	for block := uint64(0); len(out) < length; block++ {
+		mac := hmac.New(sha256.New, []byte(seed))
+		mac.Write([]byte(key))
+		counter := make([]byte, 8)
+		binary.BigEndian.PutUint64(counter, block)
+		mac.Write(counter)
+		for _, b := range mac.Sum(nil) {
+			if int(b) >= 256-256%len(alphaNum) {
+				continue
+			}
+			out = append(out, alphaNum[int(b)%len(alphaNum)])
+			if len(out) == length {
+				break
+			}
+		}
+	}
+	return string(out)
+}
+
+// countResources counts the objects of kind matching the label selector, in
+// every namespace, for the "countResources" template function. It returns
+// opts.CountDefault when there is no cluster, like when rendering to files.
+// The count goes through the clients of the apply, with its Impersonate,
+// Headers, UserAgent and ConfigHook.
+func countResources(opts Options, apiVersion, kind, selector string) (int, error) {
+	if opts.liveConfig == nil && opts.Cluster == nil {
+		return opts.CountDefault, nil
+	}
+	a := newApplier(opts.liveConfig, opts)
+	client, _, err := a.namespaceableClient(schema.FromAPIVersionAndKind(apiVersion, kind))
+	if err != nil {
+		return 0, fmt.Errorf("cannot count %s: %s", kind, err)
+	}
+	list, err := client.List(a.context(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return 0, fmt.Errorf("cannot count %s: %s", kind, err)
+	}
+	return len(list.Items), nil
+}
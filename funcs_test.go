@@ -0,0 +1,69 @@
+package kedge
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+func TestCountResourcesConfig(t *testing.T) {
+	var mu sync.Mutex
+	requests := []*http.Request{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1":
+			json.NewEncoder(w).Encode(metav1.APIResourceList{
+				TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+				GroupVersion: "v1",
+				APIResources: []metav1.APIResource{{Kind: "Node", Name: "nodes", Verbs: metav1.Verbs{"list"}}},
+			})
+		case "/api/v1/nodes":
+			w.Write([]byte(`{"apiVersion": "v1", "kind": "NodeList", "metadata": {}, "items": [{"apiVersion": "v1", "kind": "Node", "metadata": {"name": "a"}}, {"apiVersion": "v1", "kind": "Node", "metadata": {"name": "b"}}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	opts := Options{
+		UserAgent:   "deployer",
+		Headers:     http.Header{"X-Team": []string{"payments"}},
+		Impersonate: rest.ImpersonationConfig{UserName: "ci"},
+		ConfigHook: func(config *rest.Config) {
+			config.UserAgent += "/hooked"
+		},
+	}
+	opts.liveConfig = &rest.Config{Host: server.URL}
+	b, _, err := renderManifest(writeManifest(t, `nodes: {{ countResources "v1" "Node" "" }}`), "", nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(b)); got != "nodes: 2" {
+		t.Errorf("got %q, want nodes: 2", got)
+	}
+
+	if len(requests) == 0 {
+		t.Fatal("got no requests")
+	}
+	for _, r := range requests {
+		if ua := r.Header.Get("User-Agent"); ua != "deployer/hooked" {
+			t.Errorf("%s: got User-Agent %q, want deployer/hooked", r.URL.Path, ua)
+		}
+		if team := r.Header.Get("X-Team"); team != "payments" {
+			t.Errorf("%s: got X-Team %q, want payments", r.URL.Path, team)
+		}
+		if user := r.Header.Get("Impersonate-User"); user != "ci" {
+			t.Errorf("%s: got Impersonate-User %q, want ci", r.URL.Path, user)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package kedge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// generateIDLabel marks objects created from a generateName so later applies
+// find them again. See Options.TrackGenerateName.
+const generateIDLabel = "kedge.io/generate-id"
+
+// generateID returns the tracking id of a generateName object. It only
+// depends on where the object comes from in the manifest, not its content,
+// so it stays the same when the object changes.
+func generateID(obj *unstructured.Unstructured, namespace string) string {
+	key := fmt.Sprintf("%s/%s/%s", obj.GroupVersionKind().GroupKind(), namespace, obj.GetGenerateName())
+	sum := sha256.Sum256([]byte(key))
+	// label values are at most 63 characters
+	return hex.EncodeToString(sum[:])[:32]
+}
+
+// trackGeneratedName labels a generateName object with its tracking id and
+// names it after the object created by a previous apply, if there is one.
+func trackGeneratedName(ctx context.Context, client dynamic.ResourceInterface, obj *unstructured.Unstructured, namespace string) error {
+	id := generateID(obj, namespace)
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[generateIDLabel] = id
+	obj.SetLabels(labels)
+
+	list, err := client.List(ctx, metav1.ListOptions{LabelSelector: generateIDLabel + "=" + id})
+	if err != nil {
+		return err
+	}
+	switch len(list.Items) {
+	case 0:
+	case 1:
+		obj.SetName(list.Items[0].GetName())
+	default:
+		return fmt.Errorf("found %d objects labeled %s=%s, expected at most one", len(list.Items), generateIDLabel, id)
+	}
+	return nil
+}
+
+// generatedName moves what was recorded about the object of result before
+// the server generated its name to that name.
+func (a *applier) generatedName(result Result, name string) {
+	from := objectKey(result.Kind, result.Namespace, result.Name)
+	to := objectKey(result.Kind, result.Namespace, name)
+	if w, ok := a.waits[from]; ok {
+		delete(a.waits, from)
+		a.waits[to] = w
+	}
+	if desired, ok := a.desired[from]; ok {
+		delete(a.desired, from)
+		desired.SetName(name)
+		a.desired[to] = desired
+	}
+	if resume, ok := a.resume[from]; ok {
+		delete(a.resume, from)
+		a.resume[to] = resume
+	}
+	if prior, ok := a.priors[from]; ok {
+		delete(a.priors, from)
+		a.priors[to] = prior
+	}
+}
+
+// unnamed reports whether obj only sets a generateName, so the server names
+// it when it is created and there is no live object to get. With
+// Options.TrackGenerateName it is first named after the object created by a
+// previous apply, if there is one.
+func (a *applier) unnamed(ctx context.Context, client dynamic.ResourceInterface, obj *unstructured.Unstructured, namespace string) (bool, error) {
+	if obj.GetName() != "" || obj.GetGenerateName() == "" {
+		return false, nil
+	}
+	if a.opts.TrackGenerateName {
+		if err := trackGeneratedName(ctx, client, obj, namespace); err != nil {
+			return false, fmt.Errorf("ERROR: could not find generated %s '%s/%s*': %w", obj.GetKind(), namespace, obj.GetGenerateName(), err)
+		}
+	}
+	return obj.GetName() == "", nil
+}
@@ -0,0 +1,230 @@
+package kedge
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Edge kinds of a Graph.
+const (
+	// EdgeOwner goes from an object to its owner of ownerReferences.
+	EdgeOwner = "owner"
+	// EdgeSelects goes from a Service to the workloads whose pods it selects.
+	EdgeSelects = "selects"
+	// EdgeUses goes from a workload to the ConfigMaps, Secrets,
+	// ServiceAccounts and PersistentVolumeClaims its pods use.
+	EdgeUses = "uses"
+	// EdgeRoutes goes from an Ingress to the Services of its backends.
+	EdgeRoutes = "routes"
+)
+
+// Graph is the objects of a manifest and how they refer to each other. Only
+// references between objects of the manifest are edges.
+type Graph struct {
+	Nodes []ObjectRef
+	Edges []GraphEdge
+}
+
+// GraphEdge is a reference of From to To.
+type GraphEdge struct {
+	From ObjectRef
+	To   ObjectRef
+	Kind string
+}
+
+// BuildGraph renders the template and returns the graph of its objects,
+// without a cluster. Namespaces are resolved like TargetNamespaces does.
+func BuildGraph(inputFilename, namespace string, valueFilenames []string, opts Options) (*Graph, error) {
+	b, namespace, err := renderManifest(inputFilename, namespace, valueFilenames, opts)
+	if err != nil {
+		return nil, err
+	}
+	objs := []*unstructured.Unstructured{}
+	for _, doc := range splitDocuments(b) {
+		docObjs, err := decodeObjects(doc)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, docObjs...)
+	}
+	return newGraph(objs, namespace, opts), nil
+}
+
+func newGraph(objs []*unstructured.Unstructured, namespace string, opts Options) *Graph {
+	g := &Graph{Nodes: []ObjectRef{}, Edges: []GraphEdge{}}
+	refs := map[string]ObjectRef{}
+	for _, obj := range objs {
+		ref := ObjectRef{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Namespace:  targetNamespace(obj, namespace, opts),
+			Name:       obj.GetName(),
+		}
+		g.Nodes = append(g.Nodes, ref)
+		refs[objectKey(ref.Kind, ref.Namespace, ref.Name)] = ref
+	}
+	link := func(from ObjectRef, kind, namespace, name, edge string) {
+		if to, ok := refs[objectKey(kind, namespace, name)]; ok && name != "" {
+			g.Edges = append(g.Edges, GraphEdge{From: from, To: to, Kind: edge})
+		}
+	}
+
+	for i, obj := range objs {
+		from := g.Nodes[i]
+		for _, owner := range obj.GetOwnerReferences() {
+			link(from, owner.Kind, from.Namespace, owner.Name, EdgeOwner)
+			if from.Namespace != "" {
+				// namespaced objects can be owned by cluster scoped ones
+				link(from, owner.Kind, "", owner.Name, EdgeOwner)
+			}
+		}
+		if pod, ok := podTemplate(obj); ok {
+			for _, used := range podReferences(pod) {
+				link(from, used.Kind, from.Namespace, used.Name, EdgeUses)
+			}
+		}
+		switch obj.GetKind() {
+		case "Service":
+			selector, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "selector")
+			if len(selector) == 0 {
+				continue
+			}
+			for j, target := range objs {
+				pod, ok := podTemplate(target)
+				if !ok || g.Nodes[j].Namespace != from.Namespace {
+					continue
+				}
+				podLabels, _, _ := unstructured.NestedStringMap(pod, "metadata", "labels")
+				if labels.SelectorFromSet(selector).Matches(labels.Set(podLabels)) {
+					g.Edges = append(g.Edges, GraphEdge{From: from, To: g.Nodes[j], Kind: EdgeSelects})
+				}
+			}
+		case "Ingress":
+			for _, name := range ingressServices(obj) {
+				link(from, "Service", from.Namespace, name, EdgeRoutes)
+			}
+		}
+	}
+	return g
+}
+
+// podTemplate returns the pod, or pod template, of workload kinds.
+func podTemplate(obj *unstructured.Unstructured) (map[string]interface{}, bool) {
+	var path []string
+	switch obj.GetKind() {
+	case "Pod":
+		return obj.Object, true
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ReplicationController", "Job":
+		path = []string{"spec", "template"}
+	case "CronJob":
+		path = []string{"spec", "jobTemplate", "spec", "template"}
+	default:
+		return nil, false
+	}
+	pod, ok, _ := unstructured.NestedMap(obj.Object, path...)
+	return pod, ok
+}
+
+// podReferences returns the kind and name of the objects a pod refers to.
+func podReferences(pod map[string]interface{}) []ObjectRef {
+	refs := []ObjectRef{}
+	add := func(kind string, obj map[string]interface{}, fields ...string) {
+		if name, _, _ := unstructured.NestedString(obj, fields...); name != "" {
+			refs = append(refs, ObjectRef{Kind: kind, Name: name})
+		}
+	}
+	spec, _, _ := unstructured.NestedMap(pod, "spec")
+	add("ServiceAccount", spec, "serviceAccountName")
+	volumes, _, _ := unstructured.NestedSlice(spec, "volumes")
+	for _, v := range volumes {
+		if volume, ok := v.(map[string]interface{}); ok {
+			add("ConfigMap", volume, "configMap", "name")
+			add("Secret", volume, "secret", "secretName")
+			add("PersistentVolumeClaim", volume, "persistentVolumeClaim", "claimName")
+		}
+	}
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _, _ := unstructured.NestedSlice(spec, field)
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			envFrom, _, _ := unstructured.NestedSlice(container, "envFrom")
+			for _, e := range envFrom {
+				if source, ok := e.(map[string]interface{}); ok {
+					add("ConfigMap", source, "configMapRef", "name")
+					add("Secret", source, "secretRef", "name")
+				}
+			}
+			env, _, _ := unstructured.NestedSlice(container, "env")
+			for _, e := range env {
+				if variable, ok := e.(map[string]interface{}); ok {
+					add("ConfigMap", variable, "valueFrom", "configMapKeyRef", "name")
+					add("Secret", variable, "valueFrom", "secretKeyRef", "name")
+				}
+			}
+		}
+	}
+	return refs
+}
+
+// ingressServices returns the Services of the backends of an Ingress.
+func ingressServices(obj *unstructured.Unstructured) []string {
+	names := []string{}
+	if name, _, _ := unstructured.NestedString(obj.Object, "spec", "defaultBackend", "service", "name"); name != "" {
+		names = append(names, name)
+	}
+	rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+	for _, r := range rules {
+		rule, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		paths, _, _ := unstructured.NestedSlice(rule, "http", "paths")
+		for _, p := range paths {
+			if path, ok := p.(map[string]interface{}); ok {
+				if name, _, _ := unstructured.NestedString(path, "backend", "service", "name"); name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// JSON returns the graph as indented JSON.
+func (g *Graph) JSON() ([]byte, error) {
+	return json.MarshalIndent(g, "", "  ")
+}
+
+// DOT returns the graph in the Graphviz DOT language, eg for `dot -Tsvg`.
+func (g *Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph kedge {\n")
+	nodes := make([]string, 0, len(g.Nodes))
+	for _, node := range g.Nodes {
+		nodes = append(nodes, fmt.Sprintf("  %q;\n", nodeID(node)))
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		b.WriteString(node)
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "  %q -> %q [label=%q];\n", nodeID(edge.From), nodeID(edge.To), edge.Kind)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func nodeID(ref ObjectRef) string {
+	if ref.Namespace == "" {
+		return ref.Kind + "/" + ref.Name
+	}
+	return ref.Kind + "/" + ref.Namespace + "/" + ref.Name
+}
@@ -0,0 +1,103 @@
+package kedge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// immutableFields are the fields of builtin kinds the API server refuses to
+// update, by kind. Options.ImmutableFields adds to them.
+var immutableFields = map[string][]string{
+	"Deployment":            {"spec.selector"},
+	"ReplicaSet":            {"spec.selector"},
+	"DaemonSet":             {"spec.selector"},
+	"StatefulSet":           {"spec.selector", "spec.serviceName", "spec.volumeClaimTemplates", "spec.podManagementPolicy"},
+	"Job":                   {"spec.selector", "spec.template"},
+	"Service":               {"spec.clusterIP", "spec.clusterIPs"},
+	"PersistentVolumeClaim": {"spec.storageClassName", "spec.accessModes", "spec.volumeName", "spec.volumeMode"},
+	"Secret":                {"type"},
+	"StorageClass":          {"provisioner", "parameters", "reclaimPolicy", "volumeBindingMode"},
+	"RoleBinding":           {"roleRef"},
+	"ClusterRoleBinding":    {"roleRef"},
+}
+
+// immutableChanges returns the immutable fields that applying obj over live
+// would change.
+func (a *applier) immutableChanges(obj, live *unstructured.Unstructured) []string {
+	fields := append(append([]string{}, immutableFields[obj.GetKind()]...), a.opts.ImmutableFields[obj.GetKind()]...)
+	changed := []string{}
+	for _, change := range fieldChanges("", asStored(obj).Object, live.Object) {
+		if change.Old == nil && isEmptyValue(change.New) {
+			continue
+		}
+		for _, field := range fields {
+			if change.Path == field || strings.HasPrefix(change.Path, field+".") || strings.HasPrefix(change.Path, field+"[") {
+				changed = append(changed, change.Path)
+				break
+			}
+		}
+	}
+	return changed
+}
+
+// checkImmutable looks for changes of immutable fields before obj is
+// applied over live. It fails without Options.ForceReplace, which the error
+// points to, and otherwise returns true for the object to be replaced.
+func (a *applier) checkImmutable(obj, live *unstructured.Unstructured) (bool, error) {
+	changed := a.immutableChanges(obj, live)
+	if len(changed) == 0 {
+		return false, nil
+	}
+	if !a.opts.ForceReplace {
+		return false, fmt.Errorf("ERROR: %s '%s/%s' changes the immutable fields %s, set ForceReplace to delete and create it again", obj.GetKind(), obj.GetNamespace(), obj.GetName(), strings.Join(changed, ", "))
+	}
+	a.logf("[WARN] %s '%s/%s' changes the immutable fields %s, it will be replaced", obj.GetKind(), obj.GetNamespace(), obj.GetName(), strings.Join(changed, ", "))
+	return true, nil
+}
+
+// replaceIfImmutable deletes the live version of obj when applying it would
+// change immutable fields and Options.ForceReplace is set.
+func (a *applier) replaceIfImmutable(ctx context.Context, client dynamic.ResourceInterface, obj *unstructured.Unstructured) error {
+	live, err := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ERROR: could not get %s '%s/%s': %w", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+	}
+	replace, err := a.checkImmutable(obj, live)
+	if err != nil || !replace {
+		return err
+	}
+	return a.deleteForReplace(ctx, client, obj)
+}
+
+// deleteForReplace deletes obj and waits for it to be gone so it can be
+// created again.
+func (a *applier) deleteForReplace(ctx context.Context, client dynamic.ResourceInterface, obj *unstructured.Unstructured) error {
+	err := client.Delete(ctx, obj.GetName(), a.opts.deleteOptions())
+	if err != nil && !kerrors.IsNotFound(err) {
+		return fmt.Errorf("ERROR: could not delete %s '%s/%s': %w", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+	}
+	err = poll(ctx, a.opts.waitTimeout(), func(ctx context.Context) (bool, error) {
+		_, err := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if kerrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return fmt.Errorf("%s '%s/%s' was not deleted: %w", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+	}
+	if a.replacing == nil {
+		a.replacing = map[string]bool{}
+	}
+	a.replacing[objectKey(obj.GetKind(), obj.GetNamespace(), obj.GetName())] = true
+	return nil
+}
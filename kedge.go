@@ -6,9 +6,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"text/template"
 
@@ -30,29 +30,349 @@ import (
 )
 
 func Apply(config *rest.Config, inputFilename, namespace string, valueFilenames []string) error {
+	_, err := ApplyWithOptions(config, inputFilename, namespace, valueFilenames, Options{})
+	return err
+}
 
-	data, err := combineValues(valueFilenames, false)
+// ApplyWithOptions renders and installs the manifest like Apply does, using
+// opts to change how objects are sent to the cluster. The returned results
+// describe what happened to each object, in the order they were applied.
+//
+// The namespace used for rendering and for objects that don't set their own
+// is, in order of precedence:
+//
+//  1. the namespace argument, when it is not empty
+//  2. the "namespace" key of the merged values, which may itself be a
+//     template, eg `namespace: "{{ .team }}-prod"`
+//
+// Objects that set metadata.namespace keep it, unless opts.ForceNamespace is
+// set. The items of List documents are handled like single objects.
+func ApplyWithOptions(config *rest.Config, inputFilename, namespace string, valueFilenames []string, opts Options) ([]Result, error) {
+	opts.liveConfig = config
+	b, data, namespace, err := renderManifestData(inputFilename, namespace, valueFilenames, opts)
 	if err != nil {
-		return fmt.Errorf("error reading in values data: %s", err)
+		return nil, err
+	}
+
+	a := newApplier(config, opts).withSource(inputFilename, valueFilenames)
+	err = a.applyManifest(b, namespace)
+	if opts.RecordRelease {
+		release := &Release{
+			Name:       opts.releaseName(inputFilename),
+			Namespace:  namespace,
+			Source:     inputFilename,
+			ValueFiles: valueFilenames,
+			Values:     data,
+			Manifest:   string(b),
+			Options:    releaseOptions(opts),
+		}
+		if recordErr := a.recordRelease(release, err); recordErr != nil && err == nil {
+			err = recordErr
+		}
+	}
+	return a.results, err
+}
+
+// applyManifest applies every document of a rendered manifest.
+func (a *applier) applyManifest(b []byte, namespace string) error {
+	docs := splitDocuments(b)
+	// checkLimits decodes the documents, which fails without saying which
+	// one has no apiVersion or kind
+	if err := checkTypeMeta(docs); err != nil {
+		return err
+	}
+	if err := a.checkLimits(b, docs); err != nil {
+		return err
+	}
+	if a.opts.Precondition != nil {
+		ok, err := a.opts.Precondition(a.config)
+		if err != nil {
+			return fmt.Errorf("could not check the precondition: %w", err)
+		}
+		if !ok {
+			return a.skipAll(docs, namespace)
+		}
+	}
+	if a.opts.InstallOrder {
+		sortByInstallOrder(docs)
+	}
+	if a.opts.StateFile != "" {
+		if err := a.loadState(); err != nil {
+			return err
+		}
+	}
+	a.prefetchDiscovery(docs)
+	var err error
+	if a.opts.CreateNamespace != nil {
+		err = a.createNamespaces(docs, namespace)
+	}
+	if err == nil {
+		err = a.applyDocuments(docs, namespace)
+	}
+	if a.opts.StateFile != "" {
+		// save even if the apply failed so the objects that were applied
+		// are skipped next time
+		if saveErr := a.saveState(); saveErr != nil && err == nil {
+			err = saveErr
+		}
+	}
+	if err == nil && a.opts.VerifyAfterApply {
+		err = a.verifyResults()
+	}
+	if err == nil && a.opts.ExportFile != "" {
+		err = a.exportResults()
+	}
+	if a.opts.SuspendCronJobs {
+		// resume even if the apply failed, CronJobs that stay suspended
+		// silently are worse than the ones of a partial apply running
+		if resumeErr := a.resumeCronJobs(); resumeErr != nil && err == nil {
+			err = resumeErr
+		}
+	}
+	return a.explainError(err)
+}
+
+// skipAll records every object of docs as skipped, for an apply whose
+// Options.Precondition isn't met.
+func (a *applier) skipAll(docs [][]byte, namespace string) error {
+	a.logf("the precondition is not met, skipping the apply")
+	for _, doc := range docs {
+		objs, err := decodeObjects(doc)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			if err := a.record(Result{
+				APIVersion: obj.GetAPIVersion(),
+				Kind:       obj.GetKind(),
+				Namespace:  targetNamespace(obj, namespace, a.opts),
+				Name:       obj.GetName(),
+				Action:     ActionSkipped,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (a *applier) applyDocuments(docs [][]byte, namespace string) error {
+	for _, doc := range docs {
+		applied := len(a.results)
+		if err := a.createOrUpdateResource(doc, namespace); err != nil {
+			return err
+		}
+		if a.opts.Wait {
+			if err := a.waitForResults(a.results[applied:]); err != nil {
+				return err
+			}
+		}
+		if err := a.waitForAnnotated(a.results[applied:]); err != nil {
+			return err
+		}
+		if a.opts.WaitForCRDs && documentKind(doc) == "CustomResourceDefinition" {
+			if err := a.waitForCRD(doc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// context returns the context of the apply, which stops waits and requests
+// when cancelled.
+func (a *applier) context() context.Context {
+	if a.opts.Context == nil {
+		return context.Background()
+	}
+	return a.opts.Context
+}
+
+// checkLimits enforces Options.MaxManifestBytes and Options.MaxObjects
+// before anything is sent to the cluster.
+func (a *applier) checkLimits(b []byte, docs [][]byte) error {
+	if a.opts.MaxManifestBytes > 0 && len(b) > a.opts.MaxManifestBytes {
+		return fmt.Errorf("rendered manifest is %d bytes which is over the limit of %d bytes", len(b), a.opts.MaxManifestBytes)
+	}
+	if a.opts.MaxObjects <= 0 {
+		return nil
+	}
+	count := 0
+	for _, doc := range docs {
+		objs, err := decodeObjects(doc)
+		if err != nil {
+			return err
+		}
+		count += len(objs)
+	}
+	if count > a.opts.MaxObjects {
+		return fmt.Errorf("rendered manifest has %d objects which is over the limit of %d objects", count, a.opts.MaxObjects)
+	}
+	return nil
+}
+
+// renderManifest merges the values and renders the template file with them.
+// It returns the rendered manifest along with the resolved namespace.
+func renderManifest(inputFilename, namespace string, valueFilenames []string, opts Options) ([]byte, string, error) {
+	b, _, namespace, err := renderManifestData(inputFilename, namespace, valueFilenames, opts)
+	return b, namespace, err
+}
+
+// renderManifestData is renderManifest also returning the data the template
+// was rendered with.
+func renderManifestData(inputFilename, namespace string, valueFilenames []string, opts Options) ([]byte, map[string]interface{}, string, error) {
+	data, namespace, err := templateData(inputFilename, namespace, valueFilenames, opts)
+	if err != nil {
+		return nil, nil, "", err
 	}
-	data["namespace"] = namespace
 
 	f, err := os.Stat(inputFilename)
 	if err != nil {
-		return fmt.Errorf("could not stat file: %s", err)
+		return nil, nil, "", fmt.Errorf("could not stat file: %s", err)
 	}
 
-	b, err := render(f, inputFilename, data)
+	b, err := renderPasses(opts, func(opts Options) ([]byte, error) {
+		return render(f, inputFilename, filepath.Dir(inputFilename), data, templateFuncs(opts))
+	})
 	if err != nil {
-		return fmt.Errorf("could not render template: %s", err)
+		return nil, nil, "", fmt.Errorf("could not render template: %s", err)
 	}
+	if opts.StrictYAML {
+		if err := checkStrictManifest(splitDocuments(b)); err != nil {
+			return nil, nil, "", err
+		}
+	}
+	return b, data, namespace, nil
+}
 
-	return createOrUpdateResource(b, namespace, config)
+// templateData merges the values templates are rendered with. It returns
+// them along with the resolved namespace. source is the template or
+// directory being rendered, the release is named after it by default.
+//
+// The values are at the top level along with the namespace, or under
+// .Values with the release under .Release and .Chart like Helm when
+// opts.HelmValues is set.
+func templateData(source, namespace string, valueFilenames []string, opts Options) (map[string]interface{}, string, error) {
+	data, err := mergeValues(valueFilenames, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	namespace, err = resolveNamespace(namespace, data)
+	if err != nil {
+		return nil, "", err
+	}
+	if opts.HelmValues {
+		name := opts.releaseName(source)
+		return map[string]interface{}{
+			"Values": data,
+			"Chart": map[string]interface{}{
+				"Name": name,
+			},
+			"Release": map[string]interface{}{
+				"Name":      name,
+				"Namespace": namespace,
+			},
+		}, namespace, nil
+	}
+	data["namespace"] = namespace
+	return data, namespace, nil
 }
 
-func createOrUpdateResource(b []byte, namespace string, config *rest.Config) error {
-	ctx := context.TODO()
+// mergeValues merges the value files with what opts adds to them: the
+// Profile, the ValueLayers, Set, SetString and SetJSON, the defaults of the
+// ValuesSchema, and checks the RequiredValues. Templates and charts are
+// rendered with the result.
+func mergeValues(valueFilenames []string, opts Options) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	var err error
+	if opts.TemplateValues {
+		data, err = combineTemplatedValues(valueFilenames, opts)
+	} else if opts.StrictYAML {
+		if err = checkStrictValues(valueFilenames); err == nil {
+			data, err = mergeValueFiles(valueFilenames, false, newTypeWatcher(opts))
+		}
+	} else {
+		data, err = mergeValueFiles(valueFilenames, false, newTypeWatcher(opts))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading in values data: %s", err)
+	}
+	if opts.Profile != "" {
+		if data, err = applyProfile(data, opts.Profile); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ValueLayers != nil {
+		opts.logger().Printf("Merging value layers: %s", strings.Join(opts.ValueLayers.Precedence(), " < "))
+		layered, err := opts.ValueLayers.Merge()
+		if err != nil {
+			return nil, fmt.Errorf("error reading in values data: %s", err)
+		}
+		data = mergeMaps(data, layered, false)
+	}
+	if err := setValues(data, opts.Set, yaml.Unmarshal); err != nil {
+		return nil, err
+	}
+	if err := setValues(data, opts.SetString, unmarshalString); err != nil {
+		return nil, err
+	}
+	if err := setValues(data, opts.SetJSON, json.Unmarshal); err != nil {
+		return nil, err
+	}
+	if opts.ValuesSchema != "" {
+		schema, err := readValuesSchema(opts.ValuesSchema)
+		if err != nil {
+			return nil, fmt.Errorf("error reading in values schema: %s", err)
+		}
+		applySchemaDefaults(data, schema)
+	}
+	if err := checkRequiredValues(data, opts.RequiredValues); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// applier holds the state shared by every object of a single apply.
+type applier struct {
+	config   *rest.Config
+	opts     Options
+	results  []Result
+	warnings *warningCollector
+	// priors holds the state of objects before they were applied, nil for
+	// objects that didn't exist. See Options.RollbackOnFailure.
+	priors map[string]*unstructured.Unstructured
+	// resume holds the CronJobs to unsuspend, as they were sent to the
+	// server. See Options.SuspendCronJobs.
+	resume map[string]*unstructured.Unstructured
+	// waits holds the objects annotated with waitForAnnotation.
+	waits map[string]*waitFor
+	// sourceTemplate and sourceValues are what the manifest was rendered
+	// from. See Options.SourceAnnotations.
+	sourceTemplate string
+	sourceValues   []string
+	// discovery caches the API resources discovered during the apply.
+	discovery *discoveryCache
+	cluster   Cluster
+	// replacing are the objects deleted because of immutable field changes,
+	// by objectKey, which are recorded as replaced once created again.
+	replacing map[string]bool
+	// desired holds the objects as they were sent to the server. See
+	// Options.VerifyAfterApply.
+	desired map[string]*unstructured.Unstructured
+	// owner is the reference to Options.Owner once it has been looked up.
+	owner *metav1.OwnerReference
+	// state is the content of Options.StateFile.
+	state *state
+}
+
+// withSource sets what the manifest applied by a was rendered from.
+func (a *applier) withSource(template string, values []string) *applier {
+	a.sourceTemplate = template
+	a.sourceValues = values
+	return a
+}
 
+func (a *applier) createOrUpdateResource(b []byte, namespace string) error {
 	obj := unstructured.Unstructured{}
 	err := yaml.Unmarshal(b, &obj)
 	if err != nil {
@@ -65,7 +385,7 @@ func createOrUpdateResource(b []byte, namespace string, config *rest.Config) err
 			if err != nil {
 				return err
 			}
-			return createOrUpdateResource(b, namespace, config)
+			return a.createOrUpdateResource(b, namespace)
 		})
 		if err != nil {
 			return err
@@ -78,96 +398,436 @@ func createOrUpdateResource(b []byte, namespace string, config *rest.Config) err
 		// Check if gvk kind is a list, these should be ignored after checking if there are list items with 0 items
 		return nil
 	}
+	if err := a.checkGroup(gvk, obj.GetName()); err != nil {
+		return err
+	}
+
+	err = a.retry(&obj, func() error {
+		return a.applyObject(*obj.DeepCopy(), namespace)
+	})
+	var noResourceErr *NoResourceError
+	if a.opts.SkipUnresolvable && errors.As(err, &noResourceErr) {
+		a.logf("[WARN] skipping %s '%s': %s", gvk.Kind, obj.GetName(), err)
+		return a.record(Result{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       gvk.Kind,
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+			Action:     ActionSkipped,
+		})
+	}
+	return err
+}
+
+// checkGroup fails for objects of an API group which isn't one of the
+// AllowedGroups.
+func (a *applier) checkGroup(gvk schema.GroupVersionKind, name string) error {
+	if !a.opts.allowsGroup(gvk.Group) {
+		return fmt.Errorf("ERROR: %s '%s' is in the API group %q, which is not one of the AllowedGroups", gvk.Kind, name, gvk.Group)
+	}
+	return nil
+}
 
-	var dynamicClient dynamic.ResourceInterface
-	namespaceableResourceClient, isNamespaced, err := getDynamicClientOnKind(gvk.GroupVersion().String(), gvk.Kind, config)
+// applyObject applies a single object.
+func (a *applier) applyObject(obj unstructured.Unstructured, namespace string) error {
+	ctx := a.context()
+	gvk := obj.GroupVersionKind()
+
+	dynamicClient, namespace, err := a.prepareObject(&obj, namespace)
 	if err != nil {
-		return fmt.Errorf("ERROR: could not get a client to handle resource: %s", err)
+		return err
 	}
-	if isNamespaced {
-		if obj.GetNamespace() != "" {
-			namespace = obj.GetNamespace()
-		} else {
-			obj.SetNamespace(namespace)
+	if a.opts.TrackGenerateName && obj.GetName() == "" && obj.GetGenerateName() != "" {
+		if err := trackGeneratedName(ctx, dynamicClient, &obj, namespace); err != nil {
+			return fmt.Errorf("ERROR: could not find generated %s '%s/%s*': %w", gvk.Kind, namespace, obj.GetGenerateName(), err)
+		}
+	}
+	if gvk.Kind == "CronJob" && a.opts.SuspendCronJobs {
+		if err := a.suspendCronJob(&obj); err != nil {
+			return fmt.Errorf("could not suspend %s '%s/%s': %s", gvk.Kind, namespace, obj.GetName(), err)
+		}
+	}
+
+	result := Result{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       gvk.Kind,
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+	}
+	if gvk.Kind == "CronJob" {
+		result.NextSchedule = nextSchedule(&obj)
+	}
+	if value, ok := obj.GetAnnotations()[waitForAnnotation]; ok {
+		w, err := parseWaitFor(value)
+		if err != nil {
+			return fmt.Errorf("ERROR: %s '%s/%s': %s", gvk.Kind, namespace, obj.GetName(), err)
+		}
+		if a.waits == nil {
+			a.waits = map[string]*waitFor{}
+		}
+		a.waits[objectKey(gvk.Kind, result.Namespace, result.Name)] = w
+	}
+
+	if a.state != nil && obj.GetName() != "" {
+		unchanged, stateHash, err := a.stateUnchanged(&obj)
+		if err != nil {
+			return fmt.Errorf("could not hash resource '%s/%s': %s", namespace, obj.GetName(), err)
+		}
+		if unchanged {
+			a.logf("%s '%s/%s' is unchanged since the last apply", gvk.Kind, namespace, obj.GetName())
+			result.Action = ActionUnchanged
+			return a.record(result)
+		}
+		a.state.pending[objectKey(gvk.Kind, result.Namespace, obj.GetName())] = stateHash
+	}
+
+	if a.opts.RollbackOnFailure {
+		if err := a.recordPrior(ctx, dynamicClient, &obj); err != nil {
+			return fmt.Errorf("ERROR: could not get %s '%s/%s': %w", gvk.Kind, namespace, obj.GetName(), err)
+		}
+	}
+
+	hash := ""
+	if a.opts.SkipUnchanged {
+		hash, err = objectHash(&obj)
+		if err != nil {
+			return fmt.Errorf("could not hash resource '%s/%s': %s", namespace, obj.GetName(), err)
+		}
+		setAnnotation(&obj, hashAnnotation, hash)
+	}
+
+	if a.opts.ThreeWayMerge && !a.opts.ServerSideApply {
+		if err := setLastApplied(&obj); err != nil {
+			return fmt.Errorf("could not marshal resource '%s/%s': %s", namespace, obj.GetName(), err)
 		}
-		dynamicClient = namespaceableResourceClient.Namespace(namespace)
-	} else {
-		dynamicClient = namespaceableResourceClient
 	}
 
-	obj.SetSelfLink("")
-	obj.SetResourceVersion("")
-	obj.SetUID("")
-	obj.SetOwnerReferences([]metav1.OwnerReference{}) // TODO fix to original tf
+	a.debugObject(&obj)
+	if a.opts.VerifyAfterApply {
+		a.rememberDesired(&obj)
+	}
+
+	if (a.opts.CheckImmutable || a.opts.ForceReplace) && obj.GetName() != "" && !a.opts.SkipIfExists {
+		if err := a.replaceIfImmutable(ctx, dynamicClient, &obj); err != nil {
+			return err
+		}
+	}
+
+	// objects without a name yet can only be created
+	if a.opts.ServerSideApply && !a.opts.SkipIfExists && obj.GetName() != "" {
+		if hash != "" {
+			live, unchanged, err := a.unchanged(ctx, dynamicClient, obj.GetName(), hash)
+			if err != nil {
+				return fmt.Errorf("ERROR: could not get %s '%s/%s': %w", gvk.Kind, namespace, obj.GetName(), err)
+			}
+			if unchanged {
+				a.logf("%s '%s/%s' is unchanged", gvk.Kind, namespace, obj.GetName())
+				result.Action = ActionUnchanged
+				result.identify(live)
+				a.reportManagedFields(&result, live)
+				return a.record(result)
+			}
+		}
+		found := true
+		if a.opts.hasCreateOnly() {
+			found, err = exists(ctx, dynamicClient, obj.GetName())
+			if err != nil {
+				return fmt.Errorf("ERROR: could not get %s '%s/%s': %w", gvk.Kind, namespace, obj.GetName(), err)
+			}
+		}
+		applied, err := a.serverSideApply(ctx, dynamicClient, &obj, a.opts.ForceConflicts)
+		var conflictErr *ConflictError
+		if errors.As(err, &conflictErr) && a.opts.OnConflict != nil {
+			var skipped bool
+			applied, skipped, err = a.resolveConflict(ctx, dynamicClient, &obj, conflictErr)
+			if err == nil && skipped {
+				a.logf("%s '%s/%s' has conflicts. Leaving it as is", gvk.Kind, namespace, obj.GetName())
+				result.Action = ActionUnchanged
+				result.identify(applied)
+				a.reportManagedFields(&result, applied)
+				return a.record(result)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if !found {
+			applied, err = a.patchCreateOnly(ctx, dynamicClient, &obj)
+			if err != nil {
+				return fmt.Errorf("ERROR: could not patch %s '%s/%s': %w", gvk.Kind, namespace, obj.GetName(), err)
+			}
+		}
+		a.logf("%s '%s/%s' has been applied", gvk.Kind, namespace, obj.GetName())
+		a.reportMutations(&obj, applied)
+		result.Action = ActionApplied
+		result.identify(applied)
+		a.reportManagedFields(&result, applied)
+		return a.record(result)
+	}
 
-	_, err = dynamicClient.Create(ctx, &obj, metav1.CreateOptions{})
+	created, err := dynamicClient.Create(ctx, a.withCreateOnly(&obj), metav1.CreateOptions{FieldValidation: a.opts.fieldValidation()})
 	if err != nil {
 		if kerrors.IsAlreadyExists(err) {
-			log.Printf("%s '%s/%s' already exists. Updating resource", gvk.Kind, namespace, obj.GetName())
+			if a.opts.SkipIfExists {
+				a.logf("%s '%s/%s' already exists. Leaving it as is", gvk.Kind, namespace, obj.GetName())
+				live, err := dynamicClient.Get(ctx, obj.GetName(), metav1.GetOptions{})
+				if err != nil {
+					return fmt.Errorf("ERROR: could not get %s '%s/%s': %w", gvk.Kind, namespace, obj.GetName(), err)
+				}
+				result.Action = ActionUnchanged
+				result.identify(live)
+				return a.record(result)
+			}
+			if hash != "" {
+				live, unchanged, err := a.unchanged(ctx, dynamicClient, obj.GetName(), hash)
+				if err != nil {
+					return fmt.Errorf("ERROR: could not get %s '%s/%s': %w", gvk.Kind, namespace, obj.GetName(), err)
+				}
+				if unchanged {
+					a.logf("%s '%s/%s' is unchanged", gvk.Kind, namespace, obj.GetName())
+					result.Action = ActionUnchanged
+					result.identify(live)
+					return a.record(result)
+				}
+			}
+			a.logf("%s '%s/%s' already exists. Updating resource", gvk.Kind, namespace, obj.GetName())
+			if a.opts.ThreeWayMerge {
+				patched, updated, err := a.threeWayMerge(ctx, dynamicClient, &obj)
+				if err != nil {
+					return fmt.Errorf("ERROR: could not patch %s '%s/%s': %w", gvk.Kind, namespace, obj.GetName(), err)
+				}
+				if updated {
+					a.logf("%s '%s/%s' has been updated", gvk.Kind, namespace, obj.GetName())
+					a.reportMutations(&obj, patched)
+					result.Action = ActionUpdated
+				} else {
+					a.logf("%s '%s/%s' is unchanged", gvk.Kind, namespace, obj.GetName())
+					result.Action = ActionUnchanged
+				}
+				result.identify(patched)
+				return a.record(result)
+			}
 			// Get a clean mergable object
-			b, err := makeNewPatchableData(&obj)
+			b, err := a.mergePatch(&obj)
 			if err != nil {
 				return fmt.Errorf("could not marshal resource '%s/%s': %s", namespace, obj.GetName(), err)
 			}
-			_, err = dynamicClient.Patch(ctx, obj.GetName(), types.StrategicMergePatchType, b, metav1.PatchOptions{})
+			patched, err := dynamicClient.Patch(ctx, obj.GetName(), types.StrategicMergePatchType, b, metav1.PatchOptions{FieldValidation: a.opts.fieldValidation()})
 			if err != nil {
-				return fmt.Errorf("ERROR: could not patch %s '%s/%s': %s", gvk.Kind, namespace, obj.GetName(), err)
+				return fmt.Errorf("ERROR: could not patch %s '%s/%s': %w", gvk.Kind, namespace, obj.GetName(), err)
 			}
-			log.Printf("%s '%s/%s' has been updated", gvk.Kind, namespace, obj.GetName())
+			a.logf("%s '%s/%s' has been updated", gvk.Kind, namespace, obj.GetName())
+			a.reportMutations(&obj, patched)
+			result.Action = ActionUpdated
+			result.identify(patched)
+		} else if isMissingResource(err) {
+			return &NoResourceError{GroupVersionKind: gvk}
 		} else {
-			return fmt.Errorf("ERROR: could not create %s '%s/%s': %s", gvk.Kind, namespace, obj.GetName(), err)
+			return fmt.Errorf("ERROR: could not create %s '%s/%s': %w", gvk.Kind, namespace, obj.GetName(), err)
 		}
 	} else {
-		log.Printf("%s '%s/%s' has been created", gvk.Kind, namespace, obj.GetName())
+		if obj.GetName() == "" {
+			a.generatedName(result, created.GetName())
+			result.Name = created.GetName()
+		}
+		a.logf("%s '%s/%s' has been created", gvk.Kind, namespace, result.Name)
+		a.reportMutations(&obj, created)
+		result.Action = ActionCreated
+		result.identify(created)
 	}
-	return nil
+	return a.record(result)
 }
 
-// getDynamicClientOnUnstructured returns a dynamic client on an Unstructured type. This client can be further namespaced.
-func getDynamicClientOnKind(apiversion string, kind string, config *rest.Config) (dynamic.NamespaceableResourceInterface, bool, error) {
-	gvk := schema.FromAPIVersionAndKind(apiversion, kind)
-	apiRes, err := getAPIResourceForGVK(gvk, config)
+// waitForCRD waits for the CRD document to be established.
+func (a *applier) waitForCRD(doc []byte) error {
+	crd := unstructured.Unstructured{}
+	if err := yaml.Unmarshal(doc, &crd); err != nil {
+		return err
+	}
+	client, err := a.cluster.Dynamic()
+	if err != nil {
+		return err
+	}
+	return waitForCRD(a.context(), client, crd.GetName(), a.opts.crdTimeout())
+}
+
+// prepareObject gets obj ready to be sent to the cluster and returns the
+// client for it along with the namespace it ends up in.
+func (a *applier) prepareObject(obj *unstructured.Unstructured, namespace string) (dynamic.ResourceInterface, string, error) {
+	dynamicClient, namespace, err := a.resourceClient(obj, namespace)
 	if err != nil {
-		log.Printf("[ERROR] unable to get apiresource from unstructured: %s , error %s", gvk.String(), err)
-		return nil, false, errors.Wrapf(err, "unable to get apiresource from unstructured: %s", gvk.String())
+		return nil, "", err
+	}
+
+	sanitizeForApply(obj, a.opts)
+	if a.opts.Owner != nil {
+		if err := a.setOwner(obj); err != nil {
+			return nil, "", err
+		}
 	}
-	gvr := schema.GroupVersionResource{
-		Group:    apiRes.Group,
-		Version:  apiRes.Version,
-		Resource: apiRes.Name,
+	if a.opts.SourceAnnotations {
+		setSourceAnnotations(obj, a.sourceTemplate, a.sourceValues)
 	}
+	setMetadata(obj, a.opts.Labels, a.opts.Annotations)
 
-	intf, err := dynamic.NewForConfig(config)
+	if err := a.opts.Transformers.transform(obj); err != nil {
+		return nil, "", fmt.Errorf("could not transform %s '%s/%s': %s", obj.GetKind(), namespace, obj.GetName(), err)
+	}
+	return dynamicClient, namespace, nil
+}
+
+// resourceClient returns a client for the resource of obj. Namespaced objects
+// without a namespace are set to namespace and names get Options.NamePrefix
+// and NameSuffix. The namespace the object ends up in is returned, which is
+// empty for cluster scoped objects.
+func (a *applier) resourceClient(obj *unstructured.Unstructured, namespace string) (dynamic.ResourceInterface, string, error) {
+	a.opts.rename(obj)
+	gvk := obj.GroupVersionKind()
+	namespaceableResourceClient, isNamespaced, err := a.namespaceableClient(gvk)
+	var noResourceErr *NoResourceError
+	if a.opts.AutoConvertVersion && errors.As(err, &noResourceErr) {
+		if version, ok := a.preferredVersion(gvk); ok {
+			a.logf("[WARN] %s '%s' is not served as %s, applying it as %s", gvk.Kind, obj.GetName(), obj.GetAPIVersion(), version)
+			obj.SetAPIVersion(version)
+			gvk = obj.GroupVersionKind()
+			namespaceableResourceClient, isNamespaced, err = a.namespaceableClient(gvk)
+		}
+	}
 	if err != nil {
-		log.Printf("[ERROR] unable to get dynamic client %s", err)
+		return nil, "", fmt.Errorf("ERROR: could not get a client to handle resource: %w", err)
+	}
+	if !isNamespaced {
+		return namespaceableResourceClient, "", nil
+	}
+	if obj.GetNamespace() != "" && !(a.opts.ForceNamespace && namespace != "") {
+		namespace = obj.GetNamespace()
+	} else {
+		obj.SetNamespace(namespace)
+	}
+	return namespaceableResourceClient.Namespace(namespace), namespace, nil
+}
+
+// preferredVersion returns the preferred group version of the API group of
+// gvk if it serves the kind of gvk. Other groups aren't looked at, a kind
+// served by another group, eg extensions/v1beta1 Ingress as
+// networking.k8s.io/v1, is a different resource.
+func (a *applier) preferredVersion(gvk schema.GroupVersionKind) (string, bool) {
+	resources, err := a.cluster.PreferredResources()
+	if err != nil {
+		return "", false
+	}
+	for _, resource := range resources {
+		if resource.Group == gvk.Group && resource.Kind == gvk.Kind && !strings.Contains(resource.Name, "/") {
+			return schema.GroupVersion{Group: resource.Group, Version: resource.Version}.String(), true
+		}
+	}
+	return "", false
+}
+
+// unchanged reports whether the live object, which is returned, was last
+// applied with the same hash. A missing object is never unchanged.
+func (a *applier) unchanged(ctx context.Context, client dynamic.ResourceInterface, name, hash string) (*unstructured.Unstructured, bool, error) {
+	live, err := client.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil, false, nil
+		}
 		return nil, false, err
 	}
-	res := intf.Resource(gvr)
-	return res, apiRes.Namespaced, nil
+	return live, live.GetAnnotations()[hashAnnotation] == hash, nil
 }
 
-func getAPIResourceForGVK(gvk schema.GroupVersionKind, config *rest.Config) (metav1.APIResource, error) {
+// serverSideApply sends obj as a server-side apply patch. Field manager
+// conflicts are returned as a *ConflictError. The object as stored by the
+// server is returned.
+func (a *applier) serverSideApply(ctx context.Context, client dynamic.ResourceInterface, obj *unstructured.Unstructured, force bool) (*unstructured.Unstructured, error) {
+	gvk := obj.GroupVersionKind()
+	b, err := json.Marshal(obj.Object)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal resource '%s/%s': %s", obj.GetNamespace(), obj.GetName(), err)
+	}
+	applied, err := client.Patch(ctx, obj.GetName(), types.ApplyPatchType, b, metav1.PatchOptions{
+		FieldManager:    a.opts.fieldManager(gvk.Kind),
+		FieldValidation: a.opts.fieldValidation(),
+		Force:           &force,
+	})
+	if err != nil {
+		if conflictErr := newConflictError(err, gvk.Kind, obj.GetNamespace(), obj.GetName()); conflictErr != nil {
+			return nil, conflictErr
+		}
+		if isMissingResource(err) {
+			return nil, &NoResourceError{GroupVersionKind: gvk}
+		}
+		return nil, fmt.Errorf("ERROR: could not apply %s '%s/%s': %w", gvk.Kind, obj.GetNamespace(), obj.GetName(), err)
+	}
+	return applied, nil
+}
+
+// getAPIResourceForGVK discovers the resource serving gvk, through cache
+// which may be nil, logging to logger.
+func getAPIResourceForGVK(gvk schema.GroupVersionKind, config *rest.Config, cache *discoveryCache, logger Logger) (metav1.APIResource, error) {
 	res := metav1.APIResource{}
 	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
 	if err != nil {
-		log.Printf("[ERROR] unable to create discovery client %s", err)
+		logger.Printf("[ERROR] unable to create discovery client %s", err)
 		return res, err
 	}
-	resList, err := discoveryClient.ServerResourcesForGroupVersion(gvk.GroupVersion().String())
+	// Only the group version of the object is discovered so API groups that
+	// are unrelated to the manifest can't fail the apply, even when their
+	// aggregated API server is unavailable.
+	resList, cached := cache.get(gvk.GroupVersion().String())
+	if !cached {
+		resList, err = discoveryClient.ServerResourcesForGroupVersion(gvk.GroupVersion().String())
+	}
 	if err != nil {
-		log.Printf("[ERROR] unable to retrieve resource list for: %s , error: %s", gvk.GroupVersion().String(), err)
+		if kerrors.IsNotFound(err) {
+			// the group version isn't served at all, eg it has been removed
+			return res, newNoResourceError(gvk, discoveryClient, logger)
+		}
+		if kerrors.IsServiceUnavailable(err) {
+			return res, fmt.Errorf("the API server for %s is unavailable: %s", gvk.GroupVersion().String(), err)
+		}
+		logger.Printf("[ERROR] unable to retrieve resource list for: %s , error: %s", gvk.GroupVersion().String(), err)
 		return res, err
 	}
+	if !cached {
+		// writing a list read from the cache would refresh it on disk and
+		// keep it from ever expiring
+		cache.set(gvk.GroupVersion().String(), resList)
+	}
+	matches := []metav1.APIResource{}
 	for _, resource := range resList.APIResources {
 		// if a resource contains a "/" it's referencing a subresource. we don't support suberesource for now.
-		if resource.Kind == gvk.Kind && !strings.Contains(resource.Name, "/") {
-			res = resource
-			res.Group = gvk.Group
-			res.Version = gvk.Version
-			break
+		if resource.Kind != gvk.Kind || strings.Contains(resource.Name, "/") {
+			continue
+		}
+		// resources served from another group, which group versions may
+		// list, are never what the apiVersion of the object asks for
+		if (resource.Group != "" && resource.Group != gvk.Group) || (resource.Version != "" && resource.Version != gvk.Version) {
+			continue
+		}
+		matches = append(matches, resource)
+	}
+	if len(matches) > 1 {
+		names := make([]string, 0, len(matches))
+		for _, m := range matches {
+			names = append(names, m.Name)
 		}
+		return res, fmt.Errorf("kind %s is ambiguous in %s, it is served by the resources %s", gvk.Kind, gvk.GroupVersion().String(), strings.Join(names, ", "))
+	}
+	if len(matches) == 1 {
+		res = matches[0]
+		res.Group = gvk.Group
+		res.Version = gvk.Version
+		return res, nil
 	}
-	return res, nil
+	if cached {
+		// the kind may come from a CRD applied after the group version was
+		// cached, discover it again
+		cache.invalidate(gvk.GroupVersion().String())
+		return getAPIResourceForGVK(gvk, config, cache, logger)
+	}
+	return res, newNoResourceError(gvk, discoveryClient, logger)
 }
 
 func makeNewPatchableData(obj *unstructured.Unstructured) ([]byte, error) {
@@ -191,35 +851,85 @@ func makeNewPatchableData(obj *unstructured.Unstructured) ([]byte, error) {
 // This function cannot be used to generate another template since any
 // string perceived to be a template function (eg "{{" strings) will attempt to
 // be filled in by this function.
-func render(file os.FileInfo, templateFile string, data map[string]interface{}) ([]byte, error) {
-	fmap := sprig.TxtFuncMap()                   // sprig mapper for text template
-	tpl := template.New(file.Name()).Funcs(fmap) // setup sprig funcs for template
+//
+// Files relative to baseDir are available to the template as .Files and
+// through the "file" function. funcs are added on top of the sprig functions.
+func render(file os.FileInfo, templateFile, baseDir string, data map[string]interface{}, funcs template.FuncMap) ([]byte, error) {
+	files := newFiles(baseDir)
+	if _, ok := data["Files"]; !ok {
+		data["Files"] = files
+	}
+	tpl := newTemplate(file.Name(), files, funcs)
 	tpl, err := tpl.ParseFiles(templateFile)
 	if err != nil {
 		return nil, err
 	}
 
-	tmp, err := ioutil.TempFile(tmpdir(), "tmp_")
+	// Execute into memory. The rendered manifest may hold secrets so it must
+	// never be written to disk.
+	buf := bytes.NewBuffer([]byte{})
+	err = tpl.Execute(buf, data)
 	if err != nil {
 		return nil, err
 	}
-	defer os.Remove(tmp.Name()) // clean up
+	return buf.Bytes(), nil
+}
 
-	err = tpl.Execute(tmp, data) // write to new template file
-	if err != nil {
-		return nil, err
+// newTemplate returns a template set up with the sprig functions, the kedge
+// functions depending on files and funcs.
+func newTemplate(name string, files Files, funcs template.FuncMap) *template.Template {
+	var tpl *template.Template
+	fmap := sprig.TxtFuncMap() // sprig mapper for text template
+	fmap["file"] = files.Get
+	fmap["include"] = func(name string, data interface{}) (string, error) {
+		buf := bytes.NewBuffer([]byte{})
+		if err := tpl.ExecuteTemplate(buf, name, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	for name, fn := range funcs {
+		fmap[name] = fn
 	}
+	tpl = template.New(name).Funcs(fmap) // setup sprig funcs for template
+	return tpl
+}
 
-	return ioutil.ReadFile(tmp.Name()) // read the new file (again?)
+// renderString fills in a single template string with data.
+func renderString(name, text string, data map[string]interface{}) (string, error) {
+	tpl, err := template.New(name).Funcs(sprig.TxtFuncMap()).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	buf := bytes.NewBuffer([]byte{})
+	if err := tpl.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
 }
 
-func tmpdir() string {
-	t := os.TempDir()
-	_, err := os.Stat(t)
+// resolveNamespace returns namespace when set or falls back to the
+// "namespace" key of the values, rendering it if it's a template.
+func resolveNamespace(namespace string, data map[string]interface{}) (string, error) {
+	if namespace != "" {
+		return namespace, nil
+	}
+	v, ok := data["namespace"]
+	if !ok || v == nil {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("the namespace value must be a string, got %T", v)
+	}
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	ns, err := renderString("namespace", s, data)
 	if err != nil {
-		return "."
+		return "", fmt.Errorf("could not render namespace value: %s", err)
 	}
-	return t
+	return strings.TrimSpace(ns), nil
 }
 
 // combineValues merges multiple value files into a single data object. The
@@ -228,25 +938,51 @@ func tmpdir() string {
 //
 // Currently only supports YAML formatted value files.
 func combineValues(filesToMerge []string, recurseArrays bool) (map[string]interface{}, error) {
+	return mergeValueFiles(filesToMerge, recurseArrays, nil)
+}
+
+// mergeValueFiles is combineValues warning about the keys changing type
+// through types.
+func mergeValueFiles(filesToMerge []string, recurseArrays bool, types *typeWatcher) (map[string]interface{}, error) {
 	data := make(map[string]interface{})
 	for _, file := range filesToMerge {
 		d, err := readValues(file)
 		if err != nil {
 			return data, err
 		}
+		types.check(data, d, file)
 		data = mergeMaps(data, d, recurseArrays)
 	}
 	return data, nil
 }
 
+// CombineValues merges the value files in the order given and returns the
+// resulting data. This is the same data Apply renders templates with, minus
+// the namespace.
+func CombineValues(valueFilenames []string) (map[string]interface{}, error) {
+	return combineValues(valueFilenames, false)
+}
+
+// CombineValuesYAML merges the value files like CombineValues and serializes
+// the result as YAML. Map keys are sorted so the output is stable across runs
+// and can be diffed or stored as a rendered values.yaml.
+func CombineValuesYAML(valueFilenames []string) ([]byte, error) {
+	data, err := combineValues(valueFilenames, false)
+	if err != nil {
+		return nil, err
+	}
+	// ghodss/yaml goes through encoding/json which always sorts map keys
+	return yaml.Marshal(data)
+}
+
 func readValues(path string) (map[string]interface{}, error) {
-	content, err := ioutil.ReadFile(path)
+	content, err := readValueFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("unable to  read values file: %s", path)
+		return nil, fmt.Errorf("unable to read values file: %s", err)
 	}
-	data := make(map[string]interface{}, 0)
-	if err := yaml.Unmarshal(content, &data); err != nil {
-		return nil, fmt.Errorf("unable decode the values content")
+	data, err := decodeValues(path, content)
+	if err != nil {
+		return nil, fmt.Errorf("unable decode the values content of %s: %s", path, err)
 	}
 	return data, nil
 
@@ -326,3 +1062,29 @@ func KubernetesConfig(kubeconfigPath string) *rest.Config {
 	}
 	return config
 }
+
+// ConfigFromBytes returns the config of the current context of a kubeconfig
+// given as content rather than a file, eg from an environment variable or a
+// mounted secret, so it never has to be written to disk.
+func ConfigFromBytes(kubeconfig []byte) (*rest.Config, error) {
+	config, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not load kubeconfig: %s", err)
+	}
+	return config, nil
+}
+
+// ConfigForContext returns the config of the context called contextName of
+// the kubeconfig file, rather than its current context. An empty
+// kubeconfigPath uses the default kubeconfig, like kubectl, and an empty
+// contextName the current context.
+func ConfigForContext(kubeconfigPath, contextName string) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfigPath
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: contextName}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("could not load context '%s' of kubeconfig: %s", contextName, err)
+	}
+	return config, nil
+}
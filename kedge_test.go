@@ -0,0 +1,125 @@
+package kedge
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const mixedList = `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Namespace
+  metadata:
+    name: shared
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: inherits
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: own
+    namespace: shared
+`
+
+func TestApplyListNamespaces(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		// want is the namespace of each item by name
+		want map[string]string
+	}{
+		{
+			name: "items keep their namespace",
+			want: map[string]string{"shared": "", "inherits": "team", "own": "shared"},
+		},
+		{
+			name: "ForceNamespace",
+			opts: Options{ForceNamespace: true},
+			want: map[string]string{"shared": "", "inherits": "team", "own": "team"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, client := newTestCluster()
+			tt.opts.Cluster = cluster
+			results, err := ApplyWithOptions(nil, writeManifest(t, mixedList), "team", nil, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != len(tt.want) {
+				t.Fatalf("got %d results, want %d", len(results), len(tt.want))
+			}
+			for _, result := range results {
+				if result.Namespace != tt.want[result.Name] {
+					t.Errorf("%s '%s': got namespace '%s', want '%s'", result.Kind, result.Name, result.Namespace, tt.want[result.Name])
+				}
+				if result.Kind != "ConfigMap" {
+					continue
+				}
+				if _, err := client.Resource(configMapResource).Namespace(result.Namespace).Get(context.Background(), result.Name, metav1.GetOptions{}); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
+
+func TestAutoConvertVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		// want is the apiVersion the object is created as, empty when the
+		// apply fails
+		want string
+	}{
+		{
+			name:     "same group",
+			manifest: "apiVersion: autoscaling/v2beta2\nkind: HorizontalPodAutoscaler\nmetadata:\n  name: web\n",
+			want:     "autoscaling/v2",
+		},
+		{
+			name:     "other group",
+			manifest: "apiVersion: extensions/v1beta1\nkind: Ingress\nmetadata:\n  name: web\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, _ := newTestCluster()
+			verbs := metav1.Verbs{"create", "get", "list", "delete"}
+			cluster.APIResources = append(cluster.APIResources,
+				metav1.APIResource{Group: "autoscaling", Version: "v2", Kind: "HorizontalPodAutoscaler", Name: "horizontalpodautoscalers", Namespaced: true, Verbs: verbs},
+				metav1.APIResource{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress", Name: "ingresses", Namespaced: true, Verbs: verbs},
+			)
+			opts := Options{Cluster: cluster, AutoConvertVersion: true}
+			results, err := ApplyWithOptions(nil, writeManifest(t, tt.manifest), "team", nil, opts)
+			if tt.want == "" {
+				var noResourceErr *NoResourceError
+				if !errors.As(err, &noResourceErr) {
+					t.Fatalf("got %v, want a NoResourceError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 || results[0].APIVersion != tt.want {
+				t.Errorf("got %v, want the object created as %s", results, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyMissingKindWithMaxObjects(t *testing.T) {
+	cluster, _ := newTestCluster()
+	manifest := writeManifest(t, "apiVersion: v1\nmetadata:\n  name: settings\n")
+	_, err := ApplyWithOptions(nil, manifest, "team", nil, Options{Cluster: cluster, MaxObjects: 10})
+	want := "document 1 of the manifest: object 'settings' has no kind"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
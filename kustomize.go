@@ -0,0 +1,57 @@
+package kedge
+
+import (
+	"bytes"
+	"fmt"
+
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// ApplyKustomize runs a kustomize build of kustomizationDir and applies the
+// resulting manifest, the same as `kustomize build | kedge` would without
+// needing the kustomize binary.
+//
+// With opts.TemplateKustomization the built manifest is also rendered as a
+// template with the values before it's applied. Otherwise valueFilenames are
+// only used to resolve the namespace.
+func ApplyKustomize(config *rest.Config, kustomizationDir, namespace string, valueFilenames []string, opts Options) ([]Result, error) {
+	opts.liveConfig = config
+	b, namespace, err := renderKustomization(kustomizationDir, namespace, valueFilenames, opts)
+	if err != nil {
+		return nil, err
+	}
+	a := newApplier(config, opts).withSource(kustomizationDir, valueFilenames)
+	err = a.applyManifest(b, namespace)
+	return a.results, err
+}
+
+func renderKustomization(kustomizationDir, namespace string, valueFilenames []string, opts Options) ([]byte, string, error) {
+	resMap, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(filesys.MakeFsOnDisk(), kustomizationDir)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not build kustomization: %s", err)
+	}
+	b, err := resMap.AsYaml()
+	if err != nil {
+		return nil, "", fmt.Errorf("could not build kustomization: %s", err)
+	}
+
+	data, namespace, err := templateData(kustomizationDir, namespace, valueFilenames, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	if !opts.TemplateKustomization {
+		return b, namespace, nil
+	}
+
+	tpl, err := newTemplate("kustomization", newFiles(kustomizationDir), templateFuncs(opts)).Parse(string(b))
+	if err != nil {
+		return nil, "", fmt.Errorf("could not render template: %s", err)
+	}
+	buf := bytes.NewBuffer([]byte{})
+	if err := tpl.Execute(buf, data); err != nil {
+		return nil, "", fmt.Errorf("could not render template: %s", err)
+	}
+	return buf.Bytes(), namespace, nil
+}
@@ -0,0 +1,53 @@
+package kedge
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+// ApplyLive gets an existing object and applies the template inputFilename
+// rendered with the values plus the object as .Live, without its status and
+// server set metadata. This allows upgrading objects from their live state
+// rather than a stored manifest, eg
+//
+//	{{- $live := .Live }}
+//	{{- $_ := set (index $live.spec.template.spec.containers 0) "image" .image }}
+//	{{ toYaml $live }}
+//
+// namespace is where the object is looked up, it is otherwise used like by
+// ApplyWithOptions.
+func ApplyLive(config *rest.Config, gvk schema.GroupVersionKind, namespace, name, inputFilename string, valueFilenames []string, opts Options) ([]Result, error) {
+	opts.liveConfig = config
+	data, namespace, err := templateData(inputFilename, namespace, valueFilenames, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	a := newApplier(config, opts).withSource(inputFilename, valueFilenames)
+	client, err := a.clientForResult(Result{APIVersion: gvk.GroupVersion().String(), Kind: gvk.Kind, Namespace: namespace, Name: name})
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: could not get a client to handle resource: %w", err)
+	}
+	live, err := client.Get(a.context(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, a.explainError(fmt.Errorf("ERROR: could not get %s '%s/%s': %w", gvk.Kind, namespace, name, err))
+	}
+	data["Live"] = withoutServerFields(live).Object
+
+	f, err := os.Stat(inputFilename)
+	if err != nil {
+		return nil, fmt.Errorf("could not stat file: %s", err)
+	}
+	b, err := render(f, inputFilename, filepath.Dir(inputFilename), data, templateFuncs(opts))
+	if err != nil {
+		return nil, fmt.Errorf("could not render template: %s", err)
+	}
+
+	err = a.applyManifest(b, namespace)
+	return a.results, err
+}
@@ -0,0 +1,45 @@
+package kedge
+
+import (
+	"log"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Logger receives what kedge logs while applying. *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// stdLogger logs through the standard logger of the log package.
+type stdLogger struct{}
+
+func (stdLogger) Printf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+func (o Options) logger() Logger {
+	if o.Logger == nil {
+		return stdLogger{}
+	}
+	return o.Logger
+}
+
+func (a *applier) logf(format string, v ...interface{}) {
+	a.opts.logger().Printf(format, v...)
+}
+
+// debugObject logs obj as it is about to be sent to the server when
+// Options.Debug is set, with Options.RedactPaths and Secret data masked.
+func (a *applier) debugObject(obj *unstructured.Unstructured) {
+	if !a.opts.Debug {
+		return
+	}
+	b, err := yaml.Marshal(redactObject(obj, a.opts).Object)
+	if err != nil {
+		a.logf("[DEBUG] could not marshal %s '%s/%s': %s", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+		return
+	}
+	a.logf("[DEBUG] sending %s '%s/%s':\n%s", obj.GetKind(), obj.GetNamespace(), obj.GetName(), b)
+}
@@ -0,0 +1,102 @@
+package kedge
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// reportManagedFields sets the fields owned by the applying field manager in
+// stored, as read back from its managedFields, on result. See
+// Options.ReportManagedFields.
+func (a *applier) reportManagedFields(result *Result, stored *unstructured.Unstructured) {
+	if !a.opts.ReportManagedFields || stored == nil {
+		return
+	}
+	fields, err := ownedFields(stored, a.opts.fieldManager(stored.GetKind()))
+	if err != nil {
+		a.logf("[WARN] could not read the managed fields of %s '%s/%s': %s", stored.GetKind(), stored.GetNamespace(), stored.GetName(), err)
+		return
+	}
+	result.ManagedFields = fields
+}
+
+// ownedFields returns the paths of the fields manager owns in obj through
+// server-side apply, sorted. List items are written with their keys, eg
+// spec.containers[name=app].image.
+func ownedFields(obj *unstructured.Unstructured, manager string) ([]string, error) {
+	paths := []string{}
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager != manager || entry.Operation != metav1.ManagedFieldsOperationApply || entry.FieldsV1 == nil {
+			continue
+		}
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			return nil, err
+		}
+		paths = append(paths, fieldPaths("", fields)...)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// fieldPaths returns the leaves of a FieldsV1 set as paths.
+func fieldPaths(path string, fields map[string]interface{}) []string {
+	paths := []string{}
+	for key, value := range fields {
+		if key == "." {
+			continue
+		}
+		child := path
+		switch {
+		case strings.HasPrefix(key, "f:"):
+			child = joinPath(path, strings.TrimPrefix(key, "f:"))
+		case strings.HasPrefix(key, "k:"):
+			child = path + "[" + listKey(strings.TrimPrefix(key, "k:")) + "]"
+		case strings.HasPrefix(key, "v:"):
+			child = path + "[=" + strings.Trim(strings.TrimPrefix(key, "v:"), `"`) + "]"
+		case strings.HasPrefix(key, "i:"):
+			child = path + "[" + strings.TrimPrefix(key, "i:") + "]"
+		}
+		children, _ := value.(map[string]interface{})
+		if hasFields(children) {
+			paths = append(paths, fieldPaths(child, children)...)
+		} else {
+			paths = append(paths, child)
+		}
+	}
+	return paths
+}
+
+// hasFields tells whether a FieldsV1 set has children other than itself.
+func hasFields(fields map[string]interface{}) bool {
+	for key := range fields {
+		if key != "." {
+			return true
+		}
+	}
+	return false
+}
+
+// listKey formats the JSON key of a list item, eg {"name":"app"}, as
+// name=app.
+func listKey(raw string) string {
+	values := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return raw
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, values[k]))
+	}
+	return strings.Join(parts, ",")
+}
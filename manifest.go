@@ -0,0 +1,230 @@
+package kedge
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// installOrder is the order kinds are applied in when Options.InstallOrder is
+// set. It follows the order Helm installs kinds in so that dependencies like
+// namespaces, service accounts and CRDs exist before what uses them. Kinds
+// not listed here, like custom resources, are applied last.
+var installOrder = []string{
+	"Namespace",
+	"NetworkPolicy",
+	"ResourceQuota",
+	"LimitRange",
+	"PodSecurityPolicy",
+	"PodDisruptionBudget",
+	"ServiceAccount",
+	"Secret",
+	"SecretList",
+	"ConfigMap",
+	"StorageClass",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"CustomResourceDefinition",
+	"ClusterRole",
+	"ClusterRoleList",
+	"ClusterRoleBinding",
+	"ClusterRoleBindingList",
+	"Role",
+	"RoleList",
+	"RoleBinding",
+	"RoleBindingList",
+	"Service",
+	"DaemonSet",
+	"Pod",
+	"ReplicationController",
+	"ReplicaSet",
+	"Deployment",
+	"HorizontalPodAutoscaler",
+	"StatefulSet",
+	"Job",
+	"CronJob",
+	"IngressClass",
+	"Ingress",
+	"APIService",
+}
+
+// splitDocuments splits a multi-document YAML manifest on its "---"
+// separators. What follows a separator on its line, eg `--- {kind: List}`,
+// starts the next document. Documents holding nothing but whitespace and
+// comments are dropped, which is what `{{ if }}` guarded documents that are
+// disabled render to, eg a leftover "# Source: ingress.yaml" line.
+// Splitting doesn't break anchors and aliases since YAML scopes them to a
+// single document, they are expanded along with merge keys (`<<: *base`)
+// when each document is decoded.
+func splitDocuments(b []byte) [][]byte {
+	docs := [][]byte{}
+	doc := bytes.NewBuffer([]byte{})
+	flush := func() {
+		if !blankDocument(doc.Bytes()) {
+			docs = append(docs, append([]byte{}, doc.Bytes()...))
+		}
+		doc.Reset()
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(b)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "---" || strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "---\t") {
+			flush()
+			if rest := strings.TrimLeft(line[3:], " \t"); rest != "" {
+				doc.WriteString(rest)
+				doc.WriteByte('\n')
+			}
+			continue
+		}
+		doc.WriteString(line)
+		doc.WriteByte('\n')
+	}
+	flush()
+	return docs
+}
+
+// blankDocument reports whether doc has no content besides whitespace and
+// comments.
+func blankDocument(doc []byte) bool {
+	for _, line := range strings.Split(string(doc), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return false
+		}
+	}
+	return true
+}
+
+// documentKind returns the kind of a document, or an empty string if it
+// can't be decoded.
+func documentKind(doc []byte) string {
+	obj := unstructured.Unstructured{}
+	if err := yaml.Unmarshal(doc, &obj); err != nil {
+		return ""
+	}
+	return obj.GetKind()
+}
+
+// sortByInstallOrder stably sorts documents by the installOrder of their
+// kind.
+func sortByInstallOrder(docs [][]byte) {
+	sort.Stable(byRank{docs: docs, ranks: installRanks(docs)})
+}
+
+// sortByUninstallOrder stably sorts documents by the reverse installOrder of
+// their kind, so what uses a Namespace or a CRD is deleted before it.
+func sortByUninstallOrder(docs [][]byte) {
+	ranks := installRanks(docs)
+	for i := range ranks {
+		ranks[i] = -ranks[i]
+	}
+	sort.Stable(byRank{docs: docs, ranks: ranks})
+}
+
+// installRanks returns the position in installOrder of the kind of each
+// document, kinds not listed are ranked last.
+func installRanks(docs [][]byte) []int {
+	rank := make(map[string]int, len(installOrder))
+	for i, kind := range installOrder {
+		rank[kind] = i
+	}
+	ranks := make([]int, len(docs))
+	for i, doc := range docs {
+		r, ok := rank[documentKind(doc)]
+		if !ok {
+			r = len(installOrder)
+		}
+		ranks[i] = r
+	}
+	return ranks
+}
+
+type byRank struct {
+	docs  [][]byte
+	ranks []int
+}
+
+func (s byRank) Len() int           { return len(s.docs) }
+func (s byRank) Less(i, j int) bool { return s.ranks[i] < s.ranks[j] }
+func (s byRank) Swap(i, j int) {
+	s.docs[i], s.docs[j] = s.docs[j], s.docs[i]
+	s.ranks[i], s.ranks[j] = s.ranks[j], s.ranks[i]
+}
+
+// decodeObjects decodes a single document into objects. List documents are
+// expanded into their items.
+func decodeObjects(doc []byte) ([]*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal(doc, obj); err != nil {
+		return nil, fmt.Errorf("could not unmarshal resource: %s", err)
+	}
+	if !obj.IsList() {
+		if obj.GetKind() == "List" {
+			// a list without items
+			return nil, nil
+		}
+		return []*unstructured.Unstructured{obj}, nil
+	}
+	objs := []*unstructured.Unstructured{}
+	err := obj.EachListItem(func(item runtime.Object) error {
+		b, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		items, err := decodeObjects(b)
+		if err != nil {
+			return err
+		}
+		objs = append(objs, items...)
+		return nil
+	})
+	return objs, err
+}
+
+// checkTypeMeta returns an error naming the first document of docs, counted
+// from 1, with an object that has no apiVersion or kind, like when a
+// template renders them from a missing value.
+func checkTypeMeta(docs [][]byte) error {
+	for i, doc := range docs {
+		obj := map[string]interface{}{}
+		if err := yaml.Unmarshal(doc, &obj); err != nil {
+			return fmt.Errorf("document %d of the manifest: could not unmarshal resource: %s", i+1, err)
+		}
+		if err := typeMetaError(obj); err != nil {
+			return fmt.Errorf("document %d of the manifest: %s", i+1, err)
+		}
+	}
+	return nil
+}
+
+func typeMetaError(obj map[string]interface{}) error {
+	name, _, _ := unstructured.NestedString(obj, "metadata", "name")
+	for _, field := range []string{"apiVersion", "kind"} {
+		if value, _ := obj[field].(string); value == "" {
+			if name == "" {
+				return fmt.Errorf("object has no %s", field)
+			}
+			return fmt.Errorf("object '%s' has no %s", name, field)
+		}
+	}
+	items, _ := obj["items"].([]interface{})
+	for j, item := range items {
+		item, ok := item.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("item %d of the list is not an object", j+1)
+		}
+		if err := typeMetaError(item); err != nil {
+			return fmt.Errorf("item %d of the list: %s", j+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package kedge
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const anchoredManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  labels: &labels
+    app: web
+    tier: frontend
+spec:
+  selector:
+    matchLabels: *labels
+  template:
+    metadata:
+      labels: *labels
+    spec:
+      containers:
+      - &container
+        name: web
+        image: nginx:1.25
+        env:
+        - name: LEVEL
+          value: debug
+      - <<: *container
+        name: sidecar
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  labels: &labels
+    app: other
+data:
+  owner: team
+`
+
+func TestDecodeObjectsAnchors(t *testing.T) {
+	docs := splitDocuments([]byte(anchoredManifest))
+	if len(docs) != 2 {
+		t.Fatalf("got %d documents, want 2", len(docs))
+	}
+	objs, err := decodeObjects(docs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment := objs[0]
+	want := map[string]interface{}{"app": "web", "tier": "frontend"}
+	for _, path := range [][]string{
+		{"metadata", "labels"},
+		{"spec", "selector", "matchLabels"},
+		{"spec", "template", "metadata", "labels"},
+	} {
+		got, _, _ := unstructured.NestedMap(deployment.Object, path...)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got %v, want %v", path, got, want)
+		}
+	}
+
+	containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+	if len(containers) != 2 {
+		t.Fatalf("got %d containers, want 2", len(containers))
+	}
+	sidecar := containers[1].(map[string]interface{})
+	if sidecar["name"] != "sidecar" || sidecar["image"] != "nginx:1.25" {
+		t.Errorf("merge key: got %v, want the web container named sidecar", sidecar)
+	}
+	if !reflect.DeepEqual(sidecar["env"], containers[0].(map[string]interface{})["env"]) {
+		t.Errorf("merge key: got env %v, want the env of web", sidecar["env"])
+	}
+}
+
+func TestDecodeObjectsAnchorsAreScopedToTheirDocument(t *testing.T) {
+	docs := splitDocuments([]byte(anchoredManifest))
+	objs, err := decodeObjects(docs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels := objs[0].GetLabels(); labels["app"] != "other" {
+		t.Errorf("got labels %v, want the anchor redefined by the ConfigMap", labels)
+	}
+}
+
+func TestDecodeValuesAnchors(t *testing.T) {
+	content := []byte("defaults: &defaults\n  replicas: 2\n  image: nginx\nproduction:\n  <<: *defaults\n  replicas: 5\n")
+	data, err := decodeValues("values.yaml", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"replicas": float64(5), "image": "nginx"}
+	if !reflect.DeepEqual(data["production"], want) {
+		t.Errorf("got %v, want %v", data["production"], want)
+	}
+}
+
+func TestSplitDocuments(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     []string
+	}{
+		{
+			name:     "separators",
+			manifest: "---\na: 1\n---\nb: 2\n",
+			want:     []string{"a: 1\n", "b: 2\n"},
+		},
+		{
+			name:     "comment only documents",
+			manifest: "a: 1\n---\n# Source: ingress.yaml\n---\n  # indented\n\n---\nb: 2\n",
+			want:     []string{"a: 1\n", "b: 2\n"},
+		},
+		{
+			name:     "whitespace only documents",
+			manifest: "\n  \n---\n\t\n---\na: 1\n---\n",
+			want:     []string{"a: 1\n"},
+		},
+		{
+			name:     "content after the separator",
+			manifest: "--- {kind: ConfigMap}\n--- # comment\n---\tb: 2\n",
+			want:     []string{"{kind: ConfigMap}\n", "b: 2\n"},
+		},
+		{
+			name:     "dashes that aren't separators",
+			manifest: "a: |\n  ----\n  ---x\nb: \"---\"\n",
+			want:     []string{"a: |\n  ----\n  ---x\nb: \"---\"\n"},
+		},
+		{
+			name:     "anchors",
+			manifest: "a: &x 1\nb: *x\n---\nc: &x 2\n",
+			want:     []string{"a: &x 1\nb: *x\n", "c: &x 2\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs := splitDocuments([]byte(tt.manifest))
+			got := make([]string, len(docs))
+			for i, doc := range docs {
+				got[i] = string(doc)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+const guardedTemplate = `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+{{- if .ingress.enabled }}
+# Source: ingress.yaml
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+{{- end }}
+---
+# Source: configmap.yaml
+{{ if .config }}
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+{{ end }}
+`
+
+func TestDisabledDocuments(t *testing.T) {
+	tests := []struct {
+		values string
+		want   []string
+	}{
+		{"ingress: {enabled: false}\nconfig: false\n", []string{"Service"}},
+		{"ingress: {enabled: true}\nconfig: false\n", []string{"Service", "Ingress"}},
+		{"ingress: {enabled: false}\nconfig: true\n", []string{"Service", "ConfigMap"}},
+	}
+	template := writeManifest(t, guardedTemplate)
+	for _, tt := range tests {
+		values := writeManifest(t, tt.values)
+		b, _, err := renderManifest(template, "team", []string{values}, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		kinds := []string{}
+		for _, doc := range splitDocuments(b) {
+			kinds = append(kinds, documentKind(doc))
+		}
+		if !reflect.DeepEqual(kinds, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.values, kinds, tt.want)
+		}
+	}
+}
+
+func kindsOf(docs [][]byte) []string {
+	kinds := make([]string, len(docs))
+	for i, doc := range docs {
+		kinds[i] = documentKind(doc)
+	}
+	return kinds
+}
+
+func TestSortByUninstallOrder(t *testing.T) {
+	manifest := []byte(`kind: Deployment
+---
+kind: Widget
+---
+kind: Namespace
+---
+kind: CustomResourceDefinition
+---
+kind: ConfigMap
+---
+kind: Service
+`)
+	install := splitDocuments(manifest)
+	sortByInstallOrder(install)
+	uninstall := splitDocuments(manifest)
+	sortByUninstallOrder(uninstall)
+
+	want := []string{"Namespace", "ConfigMap", "CustomResourceDefinition", "Service", "Deployment", "Widget"}
+	if got := kindsOf(install); !reflect.DeepEqual(got, want) {
+		t.Errorf("install order: got %v, want %v", got, want)
+	}
+	for i, j := 0, len(want)-1; i < j; i, j = i+1, j-1 {
+		want[i], want[j] = want[j], want[i]
+	}
+	if got := kindsOf(uninstall); !reflect.DeepEqual(got, want) {
+		t.Errorf("uninstall order: got %v, want %v", got, want)
+	}
+}
+
+func TestSortByUninstallOrderIsStable(t *testing.T) {
+	docs := splitDocuments([]byte("kind: ConfigMap\nmetadata: {name: a}\n---\nkind: Namespace\n---\nkind: ConfigMap\nmetadata: {name: b}\n"))
+	sortByUninstallOrder(docs)
+	var names []string
+	for _, doc := range docs {
+		obj := unstructured.Unstructured{}
+		if err := yaml.Unmarshal(doc, &obj.Object); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, obj.GetKind()+"/"+obj.GetName())
+	}
+	want := []string{"ConfigMap/a", "ConfigMap/b", "Namespace/"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,61 @@
+package kedge
+
+import (
+	"fmt"
+	"sync"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/rest"
+)
+
+// ApplyJob is one set of inputs for ApplyMatrix, eg a single tenant.
+type ApplyJob struct {
+	Namespace      string
+	ValueFilenames []string
+	Options        Options
+}
+
+// JobResult is the outcome of a single ApplyJob.
+type JobResult struct {
+	Job     ApplyJob
+	Results []Result
+	Err     error
+}
+
+// ApplyMatrix renders and applies the same template once for each job, with
+// the job's own namespace and value files. Every job runs even if an earlier
+// one fails; the errors of all failed jobs are returned together.
+func ApplyMatrix(config *rest.Config, inputFilename string, jobs []ApplyJob) error {
+	_, err := ApplyMatrixConcurrently(config, inputFilename, jobs, 1)
+	return err
+}
+
+// ApplyMatrixConcurrently is ApplyMatrix running up to concurrency jobs at
+// the same time. The job results are returned in the same order as jobs.
+func ApplyMatrixConcurrently(config *rest.Config, inputFilename string, jobs []ApplyJob, concurrency int) ([]JobResult, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	jobResults := make([]JobResult, len(jobs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, job ApplyJob) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results, err := ApplyWithOptions(config, inputFilename, job.Namespace, job.ValueFilenames, job.Options)
+			jobResults[i] = JobResult{Job: job, Results: results, Err: err}
+		}(i, job)
+	}
+	wg.Wait()
+
+	errs := []error{}
+	for _, jobResult := range jobResults {
+		if jobResult.Err != nil {
+			errs = append(errs, fmt.Errorf("namespace '%s': %s", jobResult.Job.Namespace, jobResult.Err))
+		}
+	}
+	return jobResults, utilerrors.NewAggregate(errs)
+}
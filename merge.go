@@ -0,0 +1,109 @@
+package kedge
+
+import (
+	"context"
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// threeWayMerge patches the live object with a 3-way merge between the
+// configuration stored in its last-applied annotation, the desired object and
+// the live object. It returns false when there was nothing to patch.
+func (a *applier) threeWayMerge(ctx context.Context, client dynamic.ResourceInterface, obj *unstructured.Unstructured) (*unstructured.Unstructured, bool, error) {
+	live, err := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return nil, false, err
+	}
+	patchType, patch, err := a.threeWayMergePatch(obj, live)
+	if err != nil {
+		return nil, false, err
+	}
+	if string(patch) == "{}" {
+		return live, false, nil
+	}
+	patched, err := client.Patch(ctx, obj.GetName(), patchType, patch, metav1.PatchOptions{FieldValidation: a.opts.fieldValidation()})
+	if err != nil {
+		return nil, false, err
+	}
+	return patched, true, nil
+}
+
+// threeWayMergePatch returns the patch from live to obj. Built-in kinds get a
+// strategic merge patch, everything else (eg custom resources) a JSON merge
+// patch since there's no patch metadata for them. The patch is "{}" when
+// there's nothing to change.
+func (a *applier) threeWayMergePatch(obj, live *unstructured.Unstructured) (types.PatchType, []byte, error) {
+	original := []byte(live.GetAnnotations()[lastAppliedAnnotation])
+	modified, err := json.Marshal(obj.Object)
+	if err != nil {
+		return "", nil, err
+	}
+	current, err := json.Marshal(live.Object)
+	if err != nil {
+		return "", nil, err
+	}
+
+	patchType, patch, err := threeWayPatch(obj, original, modified, current)
+	if err != nil {
+		return "", nil, err
+	}
+	if patchType == types.StrategicMergePatchType && string(patch) != "{}" {
+		patch, err = withReplacedLists(patch, obj, a.replacedLists(obj))
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return patchType, patch, nil
+}
+
+// updatePatch returns the patch applyObject sends to update live to obj when
+// server-side apply isn't used.
+func (a *applier) updatePatch(obj, live *unstructured.Unstructured) (types.PatchType, []byte, error) {
+	if a.opts.ThreeWayMerge {
+		return a.threeWayMergePatch(obj, live)
+	}
+	b, err := a.mergePatch(obj)
+	return types.StrategicMergePatchType, b, err
+}
+
+// mergePatch returns the strategic merge patch that sets the fields of obj.
+func (a *applier) mergePatch(obj *unstructured.Unstructured) ([]byte, error) {
+	b, err := makeNewPatchableData(obj)
+	if err != nil {
+		return nil, err
+	}
+	return withReplacedLists(b, obj, a.replacedLists(obj))
+}
+
+// setLastApplied records obj in its last-applied annotation for the next
+// 3-way merge.
+func setLastApplied(obj *unstructured.Unstructured) error {
+	lastApplied, err := json.Marshal(obj.Object)
+	if err != nil {
+		return err
+	}
+	setAnnotation(obj, lastAppliedAnnotation, string(lastApplied))
+	return nil
+}
+
+func threeWayPatch(obj *unstructured.Unstructured, original, modified, current []byte) (types.PatchType, []byte, error) {
+	versioned, err := scheme.Scheme.New(obj.GroupVersionKind())
+	if err != nil {
+		// not a built-in kind
+		patch, err := jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, current)
+		return types.MergePatchType, patch, err
+	}
+	lookupPatchMeta, err := strategicpatch.NewPatchMetaFromStruct(versioned)
+	if err != nil {
+		return "", nil, err
+	}
+	patch, err := strategicpatch.CreateThreeWayMergePatch(original, modified, current, lookupPatchMeta, true)
+	return types.StrategicMergePatchType, patch, err
+}
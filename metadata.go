@@ -0,0 +1,77 @@
+package kedge
+
+import (
+	"context"
+	"encoding/json"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// setMetadata adds labels and annotations to obj, overriding the values of
+// the manifest for the same keys.
+func setMetadata(obj *unstructured.Unstructured, labels, annotations map[string]string) {
+	if len(labels) > 0 {
+		merged := obj.GetLabels()
+		if merged == nil {
+			merged = map[string]string{}
+		}
+		for k, v := range labels {
+			merged[k] = v
+		}
+		obj.SetLabels(merged)
+	}
+	for k, v := range annotations {
+		setAnnotation(obj, k, v)
+	}
+}
+
+// hasCreateOnly reports whether there is metadata to set only when objects
+// are created.
+func (o Options) hasCreateOnly() bool {
+	return len(o.CreateOnlyLabels) > 0 || len(o.CreateOnlyAnnotations) > 0
+}
+
+// withCreateOnly returns a copy of obj with the CreateOnlyLabels and
+// CreateOnlyAnnotations, for the create request. obj itself is left without
+// them so the patches of updates never touch these keys.
+func (a *applier) withCreateOnly(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	if !a.opts.hasCreateOnly() {
+		return obj
+	}
+	created := obj.DeepCopy()
+	setMetadata(created, a.opts.CreateOnlyLabels, a.opts.CreateOnlyAnnotations)
+	return created
+}
+
+// exists reports whether the object called name is on the cluster.
+func exists(ctx context.Context, client dynamic.ResourceInterface, name string) (bool, error) {
+	_, err := client.Get(ctx, name, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// patchCreateOnly sets the create-only metadata of an object server side
+// apply just created. It is a merge patch rather than part of the apply so
+// the field manager of kedge doesn't own the keys, and the next apply, which
+// leaves them out, doesn't remove them.
+func (a *applier) patchCreateOnly(ctx context.Context, client dynamic.ResourceInterface, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	// a null map in a merge patch would remove all the labels or annotations
+	metadata := map[string]interface{}{}
+	if len(a.opts.CreateOnlyLabels) > 0 {
+		metadata["labels"] = a.opts.CreateOnlyLabels
+	}
+	if len(a.opts.CreateOnlyAnnotations) > 0 {
+		metadata["annotations"] = a.opts.CreateOnlyAnnotations
+	}
+	patch, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+	if err != nil {
+		return nil, err
+	}
+	return client.Patch(ctx, obj.GetName(), types.MergePatchType, patch, metav1.PatchOptions{FieldManager: a.opts.fieldManager(obj.GetKind())})
+}
@@ -0,0 +1,160 @@
+package kedge
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const settingsManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  level: debug
+`
+
+var metadataOpts = Options{
+	Labels:           map[string]string{"managed-by": "kedge"},
+	CreateOnlyLabels: map[string]string{"created-by": "kedge"},
+}
+
+// patched is a patch the fake client received, decoded.
+type patched struct {
+	patchType types.PatchType
+	metadata  map[string]interface{}
+}
+
+// recordPatches records the patches of ConfigMaps client receives. The fake
+// can't apply strategic merge or server-side apply patches to unstructured
+// objects: the former return the live object as is and the latter store
+// the object as sent.
+func recordPatches(t *testing.T, client *fake.FakeDynamicClient) *[]patched {
+	patches := &[]patched{}
+	client.PrependReactor("patch", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		content := map[string]interface{}{}
+		if err := json.Unmarshal(patch.GetPatch(), &content); err != nil {
+			t.Fatal(err)
+		}
+		metadata, _ := content["metadata"].(map[string]interface{})
+		*patches = append(*patches, patched{patchType: patch.GetPatchType(), metadata: metadata})
+
+		tracker := client.Tracker()
+		switch patch.GetPatchType() {
+		case types.StrategicMergePatchType:
+			live, err := tracker.Get(configMapResource, patch.GetNamespace(), patch.GetName())
+			return true, live, err
+		case types.ApplyPatchType:
+			obj := &unstructured.Unstructured{Object: content}
+			_, err := tracker.Get(configMapResource, patch.GetNamespace(), patch.GetName())
+			if kerrors.IsNotFound(err) {
+				err = tracker.Create(configMapResource, obj, patch.GetNamespace())
+			} else if err == nil {
+				err = tracker.Update(configMapResource, obj, patch.GetNamespace())
+			}
+			return true, obj, err
+		}
+		// merge patches are applied by the fake
+		return false, nil, nil
+	})
+	return patches
+}
+
+func liveSettings(t *testing.T, client *fake.FakeDynamicClient) *unstructured.Unstructured {
+	t.Helper()
+	live, err := client.Resource(configMapResource).Namespace("team").Get(context.Background(), "settings", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return live
+}
+
+func TestCreateOnlyLabelsOnCreate(t *testing.T) {
+	cluster, client := newTestCluster()
+	opts := metadataOpts
+	opts.Cluster = cluster
+	if _, err := ApplyWithOptions(nil, writeManifest(t, settingsManifest), "team", nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	labels := liveSettings(t, client).GetLabels()
+	if labels["managed-by"] != "kedge" || labels["created-by"] != "kedge" {
+		t.Errorf("got labels %v, want both the labels and the create-only labels", labels)
+	}
+}
+
+func TestCreateOnlyLabelsOnUpdate(t *testing.T) {
+	existing := &unstructured.Unstructured{}
+	existing.SetAPIVersion("v1")
+	existing.SetKind("ConfigMap")
+	existing.SetNamespace("team")
+	existing.SetName("settings")
+	existing.SetLabels(map[string]string{"created-by": "someone-else"})
+	cluster, client := newTestCluster(existing)
+	patches := recordPatches(t, client)
+	opts := metadataOpts
+	opts.Cluster = cluster
+	if _, err := ApplyWithOptions(nil, writeManifest(t, settingsManifest), "team", nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(*patches) != 1 || (*patches)[0].patchType != types.StrategicMergePatchType {
+		t.Fatalf("got patches %v, want a single strategic merge patch", *patches)
+	}
+	labels, _ := (*patches)[0].metadata["labels"].(map[string]interface{})
+	if labels["managed-by"] != "kedge" {
+		t.Errorf("got patched labels %v, want managed-by=kedge", labels)
+	}
+	if _, ok := labels["created-by"]; ok {
+		t.Errorf("got patched labels %v, want the create-only label left out", labels)
+	}
+}
+
+func TestCreateOnlyLabelsServerSideApply(t *testing.T) {
+	cluster, client := newTestCluster()
+	patches := recordPatches(t, client)
+	opts := metadataOpts
+	opts.Cluster = cluster
+	opts.ServerSideApply = true
+	manifest := writeManifest(t, settingsManifest)
+
+	// create: the apply leaves the create-only labels to a merge patch so
+	// kedge doesn't own them
+	if _, err := ApplyWithOptions(nil, manifest, "team", nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(*patches) != 2 || (*patches)[0].patchType != types.ApplyPatchType || (*patches)[1].patchType != types.MergePatchType {
+		t.Fatalf("got patches %v, want an apply then a merge patch", *patches)
+	}
+	applied, _ := (*patches)[0].metadata["labels"].(map[string]interface{})
+	if _, ok := applied["created-by"]; ok {
+		t.Errorf("got applied labels %v, want the create-only label left out", applied)
+	}
+	merged, _ := (*patches)[1].metadata["labels"].(map[string]interface{})
+	if len(merged) != 1 || merged["created-by"] != "kedge" {
+		t.Errorf("got merged labels %v, want only created-by=kedge", merged)
+	}
+	if _, ok := (*patches)[1].metadata["annotations"]; ok {
+		t.Errorf("got merged annotations %v, want none so existing ones are kept", (*patches)[1].metadata["annotations"])
+	}
+
+	// update: only the apply is sent
+	*patches = nil
+	if _, err := ApplyWithOptions(nil, manifest, "team", nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(*patches) != 1 || (*patches)[0].patchType != types.ApplyPatchType {
+		t.Fatalf("got patches %v, want a single apply", *patches)
+	}
+	applied, _ = (*patches)[0].metadata["labels"].(map[string]interface{})
+	if _, ok := applied["created-by"]; ok {
+		t.Errorf("got applied labels %v, want the create-only label left out", applied)
+	}
+}
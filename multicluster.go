@@ -0,0 +1,157 @@
+package kedge
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// MultiCluster applies the same template to a fleet of clusters, picked from
+// the contexts of a kubeconfig and the kubeconfig files of a directory.
+type MultiCluster struct {
+	// Kubeconfig is the file with the contexts, the default kubeconfig when
+	// empty.
+	Kubeconfig string
+	// Contexts are the contexts of Kubeconfig to apply to. All of them when
+	// empty, unless Dir is set.
+	Contexts []string
+	// Dir is a directory of kubeconfig files, the current context of each
+	// is applied to as well. Clusters are named after the files.
+	Dir string
+	// Filter, when set, only keeps the clusters it returns true for, eg the
+	// ones whose name matches a selector.
+	Filter func(name string, config *rest.Config) bool
+	// Concurrency is the number of clusters applied to at the same time,
+	// 1 when not set.
+	Concurrency int
+}
+
+// ClusterConfig is a cluster of a MultiCluster.
+type ClusterConfig struct {
+	// Name is the context, or the kubeconfig file for MultiCluster.Dir.
+	Name   string
+	Config *rest.Config
+}
+
+// ClusterResult is the outcome of applying to one cluster.
+type ClusterResult struct {
+	Cluster string
+	Results []Result
+	Err     error
+}
+
+// Clusters returns the clusters of m, after the Filter, sorted by name.
+func (m MultiCluster) Clusters() ([]ClusterConfig, error) {
+	names := m.Contexts
+	if len(names) == 0 && m.Dir == "" {
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		rules.ExplicitPath = m.Kubeconfig
+		kubeconfig, err := rules.Load()
+		if err != nil {
+			return nil, fmt.Errorf("could not load kubeconfig: %s", err)
+		}
+		for name := range kubeconfig.Contexts {
+			names = append(names, name)
+		}
+	}
+
+	clusters := []ClusterConfig{}
+	for _, name := range names {
+		config, err := ConfigForContext(m.Kubeconfig, name)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, ClusterConfig{Name: name, Config: config})
+	}
+	if m.Dir != "" {
+		files, err := ioutil.ReadDir(m.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %s", m.Dir, err)
+		}
+		for _, f := range files {
+			if f.IsDir() {
+				continue
+			}
+			config, err := ConfigForContext(filepath.Join(m.Dir, f.Name()), "")
+			if err != nil {
+				return nil, err
+			}
+			clusters = append(clusters, ClusterConfig{Name: f.Name(), Config: config})
+		}
+	}
+
+	kept := []ClusterConfig{}
+	for _, cluster := range clusters {
+		if m.Filter == nil || m.Filter(cluster.Name, cluster.Config) {
+			kept = append(kept, cluster)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Name < kept[j].Name })
+	return kept, nil
+}
+
+// Apply renders and applies the template to every cluster of m, see
+// ApplyWithOptions. Every cluster is applied to even if another one fails;
+// the errors of all failed clusters are returned together. The results are
+// in the order of Clusters.
+//
+// Each cluster gets its own Options.StateFile and Options.ExportFile, named
+// after the cluster, eg state.prod.json for state.json, since clusters may be
+// applied to at the same time.
+func (m MultiCluster) Apply(inputFilename, namespace string, valueFilenames []string, opts Options) ([]ClusterResult, error) {
+	clusters, err := m.Clusters()
+	if err != nil {
+		return nil, err
+	}
+	concurrency := m.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	clusterResults := make([]ClusterResult, len(clusters))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, cluster := range clusters {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, cluster ClusterConfig) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			opts := opts
+			opts.StateFile = clusterFile(opts.StateFile, cluster.Name)
+			opts.ExportFile = clusterFile(opts.ExportFile, cluster.Name)
+			results, err := ApplyWithOptions(cluster.Config, inputFilename, namespace, valueFilenames, opts)
+			clusterResults[i] = ClusterResult{Cluster: cluster.Name, Results: results, Err: err}
+		}(i, cluster)
+	}
+	wg.Wait()
+
+	errs := []error{}
+	for _, clusterResult := range clusterResults {
+		if clusterResult.Err != nil {
+			errs = append(errs, fmt.Errorf("cluster '%s': %s", clusterResult.Cluster, clusterResult.Err))
+		}
+	}
+	return clusterResults, utilerrors.NewAggregate(errs)
+}
+
+// unsafeFileChars are the characters of cluster names, eg
+// arn:aws:eks:eu-west-1:1234:cluster/prod, that aren't kept in file names.
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// clusterFile returns the file path of a cluster, with the cluster name
+// before the extension. An empty path stays empty.
+func clusterFile(path, cluster string) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + unsafeFileChars.ReplaceAllString(cluster, "_") + ext
+}
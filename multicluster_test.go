@@ -0,0 +1,22 @@
+package kedge
+
+import "testing"
+
+func TestClusterFile(t *testing.T) {
+	tests := []struct {
+		path    string
+		cluster string
+		want    string
+	}{
+		{"", "prod", ""},
+		{"state.json", "prod", "state.prod.json"},
+		{"/tmp/export.yaml", "kind-dev", "/tmp/export.kind-dev.yaml"},
+		{"state", "prod", "state.prod"},
+		{"state.json", "arn:aws:eks:eu-west-1:1234:cluster/prod", "state.arn_aws_eks_eu-west-1_1234_cluster_prod.json"},
+	}
+	for _, tt := range tests {
+		if got := clusterFile(tt.path, tt.cluster); got != tt.want {
+			t.Errorf("clusterFile(%q, %q) = %q, want %q", tt.path, tt.cluster, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package kedge
+
+import (
+	"fmt"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// NamespaceMetadata is the metadata of the namespaces created by
+// Options.CreateNamespace, eg a pod-security.kubernetes.io/enforce label for
+// the admission of the cluster to accept them.
+type NamespaceMetadata struct {
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// createNamespaces creates the namespaces docs are applied to which don't
+// exist yet. Namespaces the manifest has an object for are left to it.
+func (a *applier) createNamespaces(docs [][]byte, namespace string) error {
+	targets, err := targetNamespaces(docs, namespace, a.opts)
+	if err != nil {
+		return err
+	}
+	declared := map[string]bool{}
+	for _, doc := range docs {
+		objs, err := decodeObjects(doc)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			if obj.GetAPIVersion() == "v1" && obj.GetKind() == "Namespace" {
+				declared[obj.GetName()] = true
+			}
+		}
+	}
+	names := []string{}
+	for _, ns := range targets {
+		if !declared[ns] {
+			names = append(names, ns)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	client, err := a.cluster.Dynamic()
+	if err != nil {
+		return err
+	}
+	ctx := a.context()
+	for _, name := range names {
+		ns := &unstructured.Unstructured{}
+		ns.SetAPIVersion("v1")
+		ns.SetKind("Namespace")
+		ns.SetName(name)
+		setMetadata(ns, a.opts.CreateNamespace.Labels, a.opts.CreateNamespace.Annotations)
+		created, err := client.Resource(namespaceResource).Create(ctx, ns, metav1.CreateOptions{FieldManager: a.opts.fieldManager("Namespace")})
+		if kerrors.IsAlreadyExists(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("ERROR: could not create Namespace '%s': %w", name, err)
+		}
+		a.logf("Namespace '%s' has been created", name)
+		result := Result{APIVersion: "v1", Kind: "Namespace", Name: name, Action: ActionCreated}
+		result.identify(created)
+		if err := a.record(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
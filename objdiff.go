@@ -0,0 +1,266 @@
+package kedge
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/rest"
+)
+
+// FieldChange is a single field of an object that an apply would change.
+type FieldChange struct {
+	// Path is the field path, eg "spec.template.spec.containers[0].image"
+	Path string
+	// Old is the live value, nil when the field would be added
+	Old interface{}
+	// New is the value from the manifest
+	New interface{}
+}
+
+func (c FieldChange) String() string {
+	if c.Old == nil {
+		return fmt.Sprintf("%s added %s", c.Path, formatValue(c.New))
+	}
+	return fmt.Sprintf("%s changed %s -> %s", c.Path, formatValue(c.Old), formatValue(c.New))
+}
+
+// ObjectDiff is how a single object of the manifest differs from the
+// cluster.
+type ObjectDiff struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// Exists is false when the object would be created
+	Exists bool
+	// Changes are the fields set by the manifest that differ from the live
+	// object, sorted by path.
+	Changes []FieldChange
+	// Unified is a unified diff between the live object and the manifest
+	Unified string
+}
+
+// Summary describes the changes in one line per field, eg
+// "Deployment web: spec.replicas changed 1 -> 2".
+func (d ObjectDiff) Summary() []string {
+	prefix := fmt.Sprintf("%s %s", d.Kind, d.Name)
+	if !d.Exists {
+		return []string{prefix + ": would be created"}
+	}
+	lines := make([]string, 0, len(d.Changes))
+	for _, change := range d.Changes {
+		lines = append(lines, fmt.Sprintf("%s: %s", prefix, change))
+	}
+	return lines
+}
+
+// Diff renders the manifest like Apply and compares each object with the
+// live object in the cluster without changing anything. Only fields set in
+// the manifest are compared since everything else is left alone by an apply.
+func Diff(config *rest.Config, inputFilename, namespace string, valueFilenames []string) ([]ObjectDiff, error) {
+	return DiffWithOptions(config, inputFilename, namespace, valueFilenames, Options{})
+}
+
+// DiffWithOptions is Diff using opts.
+func DiffWithOptions(config *rest.Config, inputFilename, namespace string, valueFilenames []string, opts Options) ([]ObjectDiff, error) {
+	opts.liveConfig = config
+	b, namespace, err := renderManifest(inputFilename, namespace, valueFilenames, opts)
+	if err != nil {
+		return nil, err
+	}
+	a := newApplier(config, opts)
+	diffs := []ObjectDiff{}
+	for _, doc := range splitDocuments(b) {
+		objs, err := decodeObjects(doc)
+		if err != nil {
+			return diffs, err
+		}
+		for _, obj := range objs {
+			d, err := a.diffObject(obj, namespace)
+			if err != nil {
+				return diffs, err
+			}
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs, nil
+}
+
+func (a *applier) diffObject(obj *unstructured.Unstructured, namespace string) (ObjectDiff, error) {
+	ctx := a.context()
+	// compare what an apply would send, names, labels and transformers
+	// included
+	client, namespace, err := a.prepareObject(obj, namespace)
+	if err != nil {
+		return ObjectDiff{}, err
+	}
+	unnamed, err := a.unnamed(ctx, client, obj, namespace)
+	if err != nil {
+		return ObjectDiff{}, err
+	}
+	d := ObjectDiff{Kind: obj.GetKind(), Namespace: namespace, Name: obj.GetName()}
+	if unnamed {
+		return d, nil
+	}
+
+	live, err := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return d, nil
+		}
+		return d, fmt.Errorf("ERROR: could not get %s '%s/%s': %s", d.Kind, namespace, d.Name, err)
+	}
+	d.Exists = true
+	desired := obj
+	if a.opts.ServerDryRun {
+		dryRun, err := a.dryRunUpdate(ctx, client, obj, live)
+		if err != nil {
+			return d, err
+		}
+		desired = withoutServerFields(dryRun)
+		live = withoutServerFields(live)
+	} else {
+		// fields the manifest doesn't set are left alone by an apply, don't
+		// show them as removed
+		pruned := setFields(withoutServerFields(live).Object, obj.Object)
+		live = &unstructured.Unstructured{Object: pruned.(map[string]interface{})}
+	}
+	d.Changes = fieldChanges("", desired.Object, live.Object)
+	for i, change := range d.Changes {
+		if a.opts.isRedacted(d.Kind, change.Path) {
+			d.Changes[i].Old = maskValue(change.Old, redactedBefore)
+			d.Changes[i].New = maskValue(change.New, redactedAfter)
+			if change.Old == nil {
+				d.Changes[i].Old = nil
+			}
+		}
+	}
+
+	desired, live = redactPair(desired, withoutServerFields(live), a.opts)
+	liveYAML, err := yaml.Marshal(live.Object)
+	if err != nil {
+		return d, err
+	}
+	desiredYAML, err := yaml.Marshal(desired.Object)
+	if err != nil {
+		return d, err
+	}
+	d.Unified = unifiedDiff("live", "manifest", string(liveYAML), string(desiredYAML))
+	return d, nil
+}
+
+// setFields returns the parts of the live value that the desired value sets.
+// Lists of another length than the desired one are kept whole since their
+// items can't be matched.
+func setFields(live, desired interface{}) interface{} {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return live
+		}
+		pruned := make(map[string]interface{}, len(d))
+		for k := range d {
+			if liveValue, exists := l[k]; exists {
+				pruned[k] = setFields(liveValue, d[k])
+			}
+		}
+		return pruned
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(d) {
+			return live
+		}
+		pruned := make([]interface{}, len(l))
+		for i := range l {
+			pruned[i] = setFields(l[i], d[i])
+		}
+		return pruned
+	}
+	return live
+}
+
+// withoutServerFields returns a copy of obj without the fields the API
+// server populates, which would otherwise show up in every diff.
+func withoutServerFields(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	obj = obj.DeepCopy()
+	sanitizeForApply(obj, Options{KeepOwnerReferences: true})
+	return obj
+}
+
+// removeServerFields removes the fields that only the API server sets and
+// that are left over when an object fetched from a cluster is applied again.
+func removeServerFields(obj *unstructured.Unstructured) {
+	unstructured.RemoveNestedField(obj.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(obj.Object, "metadata", "managedFields")
+	unstructured.RemoveNestedField(obj.Object, "metadata", "generation")
+	unstructured.RemoveNestedField(obj.Object, "status")
+}
+
+// fieldChanges walks the desired value and returns every leaf that differs
+// from the live value.
+func fieldChanges(path string, desired, live interface{}) []FieldChange {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(d))
+		for k := range d {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		changes := []FieldChange{}
+		for _, k := range keys {
+			liveValue, exists := l[k]
+			if !exists {
+				changes = append(changes, FieldChange{Path: joinPath(path, k), New: d[k]})
+				continue
+			}
+			changes = append(changes, fieldChanges(joinPath(path, k), d[k], liveValue)...)
+		}
+		return changes
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(d) {
+			break
+		}
+		changes := []FieldChange{}
+		for i := range d {
+			changes = append(changes, fieldChanges(fmt.Sprintf("%s[%d]", path, i), d[i], l[i])...)
+		}
+		return changes
+	}
+	if reflect.DeepEqual(desired, live) {
+		return nil
+	}
+	return []FieldChange{{Path: path, Old: live, New: desired}}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	if strings.ContainsAny(key, ".[]") {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+	return path + "." + key
+}
+
+func formatValue(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(v)
+}
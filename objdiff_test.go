@@ -0,0 +1,62 @@
+package kedge
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDiffGenerateName(t *testing.T) {
+	cluster, client := newTestCluster()
+	manifest := writeManifest(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  generateName: settings-\n")
+	diffs, err := DiffWithOptions(nil, manifest, "team", nil, Options{Cluster: cluster})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Exists {
+		t.Fatalf("got %v, want the ConfigMap created", diffs)
+	}
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "get" {
+			t.Errorf("got a get of %s, want none for a generateName object", action.GetResource().Resource)
+		}
+	}
+}
+
+func TestDiffOnlyShowsManifestFields(t *testing.T) {
+	live := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      "settings",
+			"namespace": "team",
+			"labels":    map[string]interface{}{"owner": "payments"},
+		},
+		"data": map[string]interface{}{"level": "info", "region": "eu"},
+	}}
+	cluster, _ := newTestCluster(live)
+	opts := Options{Cluster: cluster, Labels: map[string]string{"managed-by": "kedge"}}
+	diffs, err := DiffWithOptions(nil, writeManifest(t, settingsManifest), "team", nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || !diffs[0].Exists {
+		t.Fatalf("got %v, want a diff of the live ConfigMap", diffs)
+	}
+
+	// the labels of Options.Labels are applied like the manifest's
+	want := []FieldChange{
+		{Path: "data.level", Old: "info", New: "debug"},
+		{Path: "metadata.labels.managed-by", New: "kedge"},
+	}
+	if !reflect.DeepEqual(diffs[0].Changes, want) {
+		t.Errorf("got changes %v, want %v", diffs[0].Changes, want)
+	}
+	for _, untouched := range []string{"region", "owner"} {
+		if strings.Contains(diffs[0].Unified, untouched) {
+			t.Errorf("got %q in the diff, want only the fields the manifest sets:\n%s", untouched, diffs[0].Unified)
+		}
+	}
+}
@@ -0,0 +1,639 @@
+package kedge
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+)
+
+// defaultFieldManager is the field manager used for server-side apply when
+// Options.FieldManager is empty.
+const defaultFieldManager = "kedge"
+
+// Options changes how ApplyWithOptions installs a manifest. The zero value
+// behaves the same as Apply.
+type Options struct {
+	// Context cancels the apply, including any wait in progress, when it is
+	// done. Defaults to context.Background().
+	Context context.Context
+
+	// ServerSideApply sends each object as a server-side apply patch instead
+	// of creating it and falling back to a strategic merge patch.
+	ServerSideApply bool
+
+	// FieldManager is the manager name recorded by the API server for fields
+	// set by kedge. Defaults to "kedge". Use a different FieldManager per
+	// ApplyJob to keep the components of a matrix apply apart.
+	FieldManager string
+
+	// FieldManagers overrides FieldManager for objects of specific kinds, eg
+	// {"NetworkPolicy": "kedge-network"}, so components applying different
+	// kinds of the same manifest don't take over each others fields.
+	FieldManagers map[string]string
+
+	// ForceConflicts sets force on server-side apply patches so kedge takes
+	// ownership of fields owned by other field managers instead of failing
+	// with a ConflictError. Only field ownership changes: objects are never
+	// deleted or recreated, which makes this unrelated to replacing objects
+	// whose immutable fields changed. It has no effect without
+	// ServerSideApply.
+	ForceConflicts bool
+
+	// OnConflict is called when a server-side apply conflicts with fields
+	// owned by other field managers, instead of failing with a
+	// ConflictError. It decides whether to retry, force, skip the object or
+	// abort, and may change the object first, eg to drop the conflicting
+	// fields. Other patches kedge sends don't carry a resourceVersion so they
+	// never conflict.
+	OnConflict ConflictFunc
+
+	// ServerDryRun makes Diff send the update an apply would send for each
+	// existing object in dry run mode, a server-side apply with
+	// ServerSideApply and the patch otherwise, and compare what the server
+	// would store with the live object. Unlike a local diff this includes
+	// defaulting, changes made by mutating admission webhooks and fields a
+	// ThreeWayMerge removes, so fields the manifest doesn't set show up too
+	// when the server changes them.
+	ServerDryRun bool
+
+	// VerifyAfterApply gets every object again once the whole manifest has
+	// been applied and compares the fields set by the manifest with the live
+	// object. Fields that didn't take are reported in Result.Drift. Values
+	// the server normalizes, eg a cpu of "1000m" stored as "1", are reported
+	// too.
+	VerifyAfterApply bool
+
+	// Owner makes every object applied a dependent of an existing object, so
+	// Kubernetes garbage collects them when the owner is deleted. Namespaced
+	// dependents must be in the namespace of the owner, unless it is cluster
+	// scoped. See ReconcileOwned to delete dependents removed from the
+	// manifest.
+	Owner *ObjectRef
+
+	// StateFile is a file where kedge stores a hash of every object it
+	// applied. Objects whose hash didn't change since the last apply to the
+	// same cluster are skipped without sending them. Changes made to the
+	// objects in the cluster are not undone for those, remove the file to
+	// apply everything again. The file is readable by its owner only. It
+	// must not be shared by applies running at the same time, the last one
+	// to finish would overwrite the others; MultiCluster.Apply gives each
+	// cluster its own.
+	StateFile string
+
+	// ForceNamespace puts every namespaced object, including the items of
+	// List documents, in the resolved namespace even when it sets its own
+	// metadata.namespace. Cluster scoped objects are not affected.
+	ForceNamespace bool
+
+	// Retries is how many times an object is applied again when the API
+	// server fails with an error that may be transient, like a webhook
+	// failing or a timeout. The kedge.io/retries annotation overrides it for
+	// single objects. Defaults to no retries.
+	Retries int
+
+	// SkipUnresolvable carries on with the apply when the cluster doesn't
+	// serve the kind of an object, eg because the CRD of an optional
+	// component isn't installed. Such objects are logged and reported with
+	// ActionSkipped instead of failing the apply.
+	SkipUnresolvable bool
+
+	// RandomSeed is the secret the "stableRandAlphaNum" template function
+	// derives its values from, eg `{{ stableRandAlphaNum "db-password" 24 }}`.
+	// The same seed and key always give the same value so generated
+	// passwords don't change, and roll the Secrets using them, on every
+	// apply. Keep it out of values files, like any other secret.
+	RandomSeed string
+
+	// SkipUnchanged stores a hash of each rendered object in the
+	// kedge.io/last-applied-hash annotation and skips the update when the
+	// object in the cluster carries the same hash. Changes made to the object
+	// by anything other than kedge are not detected.
+	SkipUnchanged bool
+
+	// ThreeWayMerge records the applied configuration in the
+	// kubectl.kubernetes.io/last-applied-configuration annotation and computes
+	// updates as a 3-way merge between it, the manifest and the live object,
+	// the same way kubectl apply does. Fields removed from the manifest are
+	// then removed from the cluster instead of lingering. It has no effect
+	// with ServerSideApply, which tracks removed fields on its own.
+	ThreeWayMerge bool
+
+	// SkipIfExists only creates objects. Objects that already exist are left
+	// exactly as they are and reported as unchanged, so defaults that users
+	// may have customized are never overwritten.
+	SkipIfExists bool
+
+	// PropagationPolicy controls how dependents are garbage collected when
+	// Delete removes an object. Foreground blocks the deletion until the
+	// dependents are gone and Orphan leaves them in place. Defaults to
+	// Background, like kubectl.
+	PropagationPolicy metav1.DeletionPropagation
+
+	// GracePeriodSeconds overrides the termination grace period of the
+	// objects Delete removes, like pods. 0 deletes them right away, without
+	// waiting for them to terminate, for pods stuck terminating. Nil keeps
+	// the grace period of each object.
+	GracePeriodSeconds *int64
+
+	// SecretResolver resolves the "secret" template function, eg
+	// `{{ secret "db/password" }}`. Rendering fails when a template uses the
+	// function and no resolver is set.
+	SecretResolver SecretResolver
+
+	// ExternalResolvers resolve values from external stores by scheme. The
+	// "external" template function works with any scheme, eg
+	// `{{ external "aws-sm" "prod/app" "password" }}`, and schemes that are
+	// valid identifiers also get a function of their own, eg
+	// `{{ vault "secret/data/app" "password" }}`. Rendering fails when a
+	// template uses a scheme without a resolver.
+	ExternalResolvers map[string]ExternalResolver
+
+	// ValueLayers are merged on top of the value files passed to
+	// ApplyWithOptions, in the order the layers were added.
+	ValueLayers *ValueLayers
+
+	// InstallOrder applies the documents of the manifest sorted by kind so
+	// that dependencies like Namespaces, ServiceAccounts and CRDs are applied
+	// before what uses them. Documents are applied in file order otherwise.
+	// Delete goes in the reverse order, so a Namespace the manifest holds is
+	// deleted after the objects in it and CRDs after their custom resources.
+	InstallOrder bool
+
+	// WaitForCRDs waits for every applied CustomResourceDefinition to be
+	// established before applying the next document. Combined with
+	// InstallOrder this lets a manifest hold both CRDs and custom resources.
+	WaitForCRDs bool
+
+	// CRDTimeout is how long WaitForCRDs waits for each CRD. Defaults to one
+	// minute.
+	CRDTimeout time.Duration
+
+	// UserAgent is sent with every API request so kedge traffic can be told
+	// apart in audit logs. Defaults to the UserAgent of the config, or
+	// "kedge/<version>" if it has none.
+	UserAgent string
+
+	// Headers are added to every API request, eg for gateways routing on
+	// headers.
+	Headers http.Header
+
+	// Transformers change objects of specific kinds before they are applied,
+	// eg to enforce an imagePullPolicy on every Deployment.
+	Transformers *Transformers
+
+	// WarningsAsErrors fails the apply when the API server returns warnings
+	// for an object, eg because it uses a deprecated apiVersion.
+	WarningsAsErrors bool
+
+	// KeepServerFields sends metadata.creationTimestamp,
+	// metadata.managedFields, metadata.generation and status as they are in
+	// the manifest. By default they are removed since they are set by the API
+	// server and only show up in manifests exported from a cluster, where they
+	// make applies noisy or fail.
+	KeepServerFields bool
+
+	// KeepOwnerReferences sends metadata.ownerReferences as they are in the
+	// manifest. By default they are removed since the UIDs of the owners
+	// rarely exist in the cluster applied to. Owner sets them regardless.
+	KeepOwnerReferences bool
+
+	// MaxManifestBytes aborts the apply before anything is sent to the
+	// cluster when the rendered manifest is larger than this many bytes. Zero
+	// means no limit.
+	MaxManifestBytes int
+
+	// MaxObjects aborts the apply before anything is sent to the cluster when
+	// the rendered manifest has more objects than this, counting the items of
+	// Lists. It guards against template bugs like a runaway range. Zero means
+	// no limit.
+	MaxObjects int
+
+	// RedactPaths lists dotted field paths, by kind, whose values are masked
+	// in anything kedge displays, like logs and diffs. The data and
+	// stringData of Secrets are always masked. Objects are still applied
+	// with their real values.
+	RedactPaths map[string][]string
+
+	// Wait blocks after each object is applied until Deployments,
+	// StatefulSets and DaemonSets have rolled out.
+	Wait bool
+
+	// WaitTimeout is how long Wait waits for each object. Defaults to five
+	// minutes.
+	WaitTimeout time.Duration
+
+	// RollbackOnFailure records the state of each object before applying it.
+	// When Wait times out, the object is restored to that state, or deleted
+	// if it didn't exist before, so a bad rollout doesn't leave the workload
+	// stuck.
+	RollbackOnFailure bool
+
+	// TemplateKustomization renders the output of the kustomize build done by
+	// ApplyKustomize as a template before applying it.
+	TemplateKustomization bool
+
+	// TemplateValues renders each value file as a template before it is
+	// merged, eg `region: "{{ env "AWS_REGION" }}"`. Files are rendered in
+	// order with the values merged from the files before them.
+	TemplateValues bool
+
+	// SuspendCronJobs applies CronJobs with spec.suspend set so no job is
+	// scheduled while the rest of the manifest is applied. They are resumed
+	// once everything has been applied, or the apply failed, unless the
+	// manifest suspends them. With ServerSideApply they are resumed by
+	// applying them again so the field manager keeps owning spec.suspend.
+	SuspendCronJobs bool
+
+	// ConfigHook is called with the rest.Config kedge builds its clients from,
+	// after kedge's own settings like UserAgent and Headers are set. It can
+	// change anything, eg wrap the transport to log requests. The hook gets a
+	// copy so the config passed to kedge is never changed.
+	ConfigHook func(config *rest.Config)
+
+	// Impersonate applies as another user and/or groups, eg to check what a
+	// restricted service account is allowed to do. Errors due to the RBAC
+	// rules of the impersonated user say so.
+	Impersonate rest.ImpersonationConfig
+
+	// Set overrides values like `--set`, each entry being `path=value` with
+	// a dotted path, eg `image.tag=1.2.3`. The value is parsed as YAML 1.1
+	// so `replicas=3` sets a number, and so do `1e3`, `1.20` (1.2) and
+	// `0012`, the octal 10, while `on`, `no` and `true` set bools. Use
+	// SetString for values that must stay strings, eg versions.
+	Set []string
+
+	// SetString overrides values like `--set-string`, with `path=value`
+	// entries like Set whose values are always kept as strings.
+	SetString []string
+
+	// SetJSON overrides values with JSON, each entry being `path=json`, eg
+	// `resources={"limits":{"cpu":"2"}}`. Objects are merged into the values
+	// at path. Set, SetString and SetJSON take precedence over any value
+	// file or layer and are applied in that order.
+	SetJSON []string
+
+	// TrackGenerateName labels objects using metadata.generateName with an id
+	// derived from their kind, namespace and generateName. Later applies
+	// update the object carrying that label instead of creating another one.
+	TrackGenerateName bool
+
+	// ValuesSchema is the path of a JSON schema, in JSON or YAML, whose
+	// property defaults fill in the values no value file or override set,
+	// eg `{"properties": {"replicas": {"default": 1}}}`.
+	ValuesSchema string
+
+	// Logger receives what kedge logs while applying, like the objects
+	// created and the warnings of the API server. Defaults to the standard
+	// logger of the log package.
+	Logger Logger
+
+	// Debug also logs each object in YAML right before it is sent to the
+	// server. Values masked by RedactPaths, and Secret data, stay masked.
+	Debug bool
+
+	// SourceAnnotations stamps every object with the kedge.io/source-template
+	// and kedge.io/source-values annotations, recording the template, chart
+	// or kustomization and the value files it was rendered from.
+	SourceAnnotations bool
+
+	// Labels and Annotations are added to every object, overriding the
+	// values of the manifests for the same keys.
+	Labels      map[string]string
+	Annotations map[string]string
+
+	// CreateOnlyLabels and CreateOnlyAnnotations are only set when an object
+	// is created. Updates leave them out of the patch, so changes made to
+	// them later, by users or controllers, are kept.
+	CreateOnlyLabels      map[string]string
+	CreateOnlyAnnotations map[string]string
+
+	// ExportFile is a file the applied objects are written to after a
+	// successful apply, as a multi document YAML manifest. Objects are
+	// fetched again so they hold the defaults of the server, without the
+	// fields only the server sets like status and resourceVersion. Secrets
+	// are exported with their data, so the file is only readable by its
+	// owner, mode 0600. Like StateFile, it must not be shared by applies
+	// running at the same time.
+	ExportFile string
+
+	// DetectMutations warns, in Result.Warnings, about the fields the server
+	// stores with other values than the manifest sets, eg because a
+	// mutating webhook rewrites them. These objects are changed on every
+	// apply. Fields the server normalizes, like quantities, are reported too.
+	DetectMutations bool
+
+	// StrictYAML fails value files and rendered manifests with a mapping
+	// defining the same key twice, naming the key and its lines. Otherwise
+	// the last value wins silently.
+	StrictYAML bool
+
+	// Precondition is checked before anything is applied, with the config of
+	// the apply. When it returns false nothing is applied and every object
+	// is reported with ActionSkipped, eg to only roll out while a feature
+	// flag ConfigMap is set.
+	Precondition func(config *rest.Config) (bool, error)
+
+	// WarnTypeChanges logs a warning whenever a value file sets a key to
+	// another type than the files before it, eg `replicas: "3"` over
+	// `replicas: 3`, naming the key and both files.
+	WarnTypeChanges bool
+
+	// CountDefault is what the "countResources" template function returns
+	// when rendering without a cluster, like RenderToDir. With a cluster,
+	// `{{ countResources "v1" "Node" "node-role.kubernetes.io/worker" }}`
+	// counts the matching objects in every namespace.
+	CountDefault int
+
+	// ReplaceLists are, by kind, the list fields strategic merge patches
+	// replace as a whole rather than merge, for lists whose order matters,
+	// eg {"Deployment": {"spec.template.spec.containers"}}. Objects can name
+	// their own in the kedge.io/replace-lists annotation, comma separated.
+	// Server-side apply doesn't use them.
+	ReplaceLists map[string][]string
+
+	// AutoConvertVersion applies objects whose apiVersion the cluster no
+	// longer serves under the preferred version of their API group, eg
+	// autoscaling/v2 for autoscaling/v2beta2. Kinds only served by another
+	// group still fail the apply. Only the apiVersion is rewritten, fields
+	// which changed between the versions still fail the apply.
+	AutoConvertVersion bool
+
+	// RecordRelease records every apply, failed ones included, as a revision
+	// of the release, see ReleaseName, in a Secret of the namespace of the
+	// apply with the rendered manifest and values. See ListReleases and
+	// Rollback.
+	RecordRelease bool
+
+	// Profile is a preset of values to merge over the value files, from
+	// their top level "profiles" map, eg "prod" for
+	//
+	//	replicas: 1
+	//	profiles:
+	//	  prod:
+	//	    replicas: 3
+	//
+	// The profiles are then removed from the values. Value layers and Set
+	// still override the profile. Without a Profile the values are left as
+	// is.
+	Profile string
+
+	// DiscoveryCacheDir is a directory the API resources discovered are
+	// cached in, by API server, so short lived processes applying to the
+	// same cluster don't discover them every time. Kinds missing from the
+	// cache, like the ones of new CRDs, are discovered again.
+	DiscoveryCacheDir string
+
+	// DiscoveryCacheTTL is how long the lists cached in DiscoveryCacheDir are
+	// used for. Defaults to 10 minutes.
+	DiscoveryCacheTTL time.Duration
+
+	// RequiredValues are the dotted paths of values that must be set, eg
+	// "image.repository". They are checked once the values are merged, with
+	// the defaults of ValuesSchema, and any missing one fails the render.
+	RequiredValues []string
+
+	// NamePrefix and NameSuffix are added to the name of every object, to
+	// apply several copies of a manifest side by side. Objects with a
+	// generateName only get the prefix. Namespaces, CRDs and APIServices,
+	// whose names can't change freely, keep their names.
+	//
+	// References between objects, like the ConfigMap of a Deployment, are
+	// not rewritten and still point to the names of the manifest. Templates
+	// have to add the prefix and suffix to them themselves.
+	NamePrefix string
+	NameSuffix string
+
+	// Cluster, when set, is what objects are applied to instead of the
+	// cluster of the config, eg a StaticCluster with a fake dynamic client
+	// in tests. Features using other clients, like Wait, CreateNamespace,
+	// RecordRelease and pruning, still go through the config.
+	Cluster Cluster
+
+	// CheckImmutable compares objects with their live version before
+	// applying them and fails, naming the fields, when fields the API server
+	// won't update change, like the selector of a Deployment. Without it the
+	// patch fails on the server instead.
+	CheckImmutable bool
+
+	// ImmutableFields adds, by kind, to the fields CheckImmutable knows are
+	// immutable, eg {"MyResource": {"spec.storage"}} for custom resources.
+	ImmutableFields map[string][]string
+
+	// ForceReplace deletes and creates again the objects whose immutable
+	// fields change, and implies CheckImmutable. They are reported with
+	// ActionReplaced. Unlike ForceConflicts, which only takes over field
+	// ownership, this destroys the object and what it holds, eg the pods
+	// of a Deployment.
+	ForceReplace bool
+
+	// ReportManagedFields reads back the managedFields of objects after a
+	// server-side apply and sets Result.ManagedFields to the fields owned by
+	// the field manager, eg to check which fields other controllers keep.
+	// It has no effect without ServerSideApply.
+	ReportManagedFields bool
+
+	// AllowedGroups restricts the API groups of the objects that are applied,
+	// eg {"", "apps", "example.com"} where "" is the core group. Objects of
+	// other groups are rejected before the cluster is called, so a template
+	// can't create, say, a ClusterRoleBinding. Deletes, including the prunes
+	// of Rollback and ReconcileOwned, and ApplyStatus are restricted the same
+	// way. Nil allows every group.
+	AllowedGroups []string
+
+	// TwoPassRender renders templates twice so documents can use values
+	// shared by the documents after them, eg a Deployment reading a
+	// password generated in a later Secret. Templates share a value with
+	// `{{ share "dbPassword" (randAlphaNum 16) }}`, which also outputs it,
+	// and read it with `{{ shared "dbPassword" }}`. The value shared in the
+	// first pass is kept in the second one. Without TwoPassRender only
+	// values shared by earlier documents can be read. Template functions
+	// calling out, like "countResources", run in both passes.
+	TwoPassRender bool
+
+	// CreateNamespace creates the namespaces objects are applied to when
+	// they don't exist, with the labels and annotations it holds. Namespaces
+	// the manifest has a Namespace object for are left to it. Nil, the
+	// default, doesn't create any.
+	CreateNamespace *NamespaceMetadata
+
+	// FieldValidation is how the API server handles fields of a manifest
+	// that are unknown or duplicated: "Ignore" drops them silently, "Warn"
+	// drops them with a warning attached to the Result, and "Strict" fails
+	// the request. Defaults to "Warn".
+	FieldValidation string
+
+	// HelmValues renders templates with Helm's layout: the values are under
+	// .Values and the release under .Release and .Chart, eg
+	// `{{ .Values.image }}` and `{{ .Release.Namespace }}`. By default the
+	// merged values are at the top level along with the resolved
+	// `namespace`, eg `{{ .image }}`, like Apply.
+	HelmValues bool
+
+	// ReleaseName is .Release.Name and .Chart.Name of templates. Defaults to
+	// the name of the template, or directory, without its extension.
+	ReleaseName string
+
+	// liveConfig is the cluster template functions like "countResources"
+	// query, set by the functions given a config before they render.
+	liveConfig *rest.Config
+
+	// shared are the values of the "share" template function for the
+	// render in progress, see TwoPassRender.
+	shared *sharedValues
+}
+
+func (o Options) propagationPolicy() metav1.DeletionPropagation {
+	if o.PropagationPolicy == "" {
+		return metav1.DeletePropagationBackground
+	}
+	return o.PropagationPolicy
+}
+
+func (o Options) deleteOptions() metav1.DeleteOptions {
+	propagationPolicy := o.propagationPolicy()
+	return metav1.DeleteOptions{PropagationPolicy: &propagationPolicy, GracePeriodSeconds: o.GracePeriodSeconds}
+}
+
+func (o Options) crdTimeout() time.Duration {
+	if o.CRDTimeout == 0 {
+		return defaultCRDTimeout
+	}
+	return o.CRDTimeout
+}
+
+func (o Options) releaseName(source string) string {
+	if o.ReleaseName != "" {
+		return o.ReleaseName
+	}
+	name := filepath.Base(source)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// rename adds NamePrefix and NameSuffix to the name of obj.
+func (o Options) rename(obj *unstructured.Unstructured) {
+	if o.NamePrefix == "" && o.NameSuffix == "" {
+		return
+	}
+	switch obj.GetKind() {
+	case "Namespace", "CustomResourceDefinition", "APIService":
+		return
+	}
+	if obj.GetName() != "" {
+		obj.SetName(o.NamePrefix + obj.GetName() + o.NameSuffix)
+	} else if obj.GetGenerateName() != "" {
+		// the random part is added after generateName
+		obj.SetGenerateName(o.NamePrefix + obj.GetGenerateName())
+	}
+}
+
+// allowsGroup tells whether objects of the API group may be applied or
+// deleted. See AllowedGroups.
+func (o Options) allowsGroup(group string) bool {
+	if o.AllowedGroups == nil {
+		return true
+	}
+	for _, allowed := range o.AllowedGroups {
+		if allowed == group {
+			return true
+		}
+	}
+	return false
+}
+
+func (o Options) fieldValidation() string {
+	if o.FieldValidation == "" {
+		return metav1.FieldValidationWarn
+	}
+	return o.FieldValidation
+}
+
+func (o Options) waitTimeout() time.Duration {
+	if o.WaitTimeout == 0 {
+		return defaultWaitTimeout
+	}
+	return o.WaitTimeout
+}
+
+func (o Options) fieldManager(kind string) string {
+	if manager, ok := o.FieldManagers[kind]; ok && manager != "" {
+		return manager
+	}
+	if o.FieldManager == "" {
+		return defaultFieldManager
+	}
+	return o.FieldManager
+}
+
+// Action is what kedge did with an object.
+type Action string
+
+const (
+	// ActionCreated means the object did not exist and was created.
+	ActionCreated Action = "created"
+	// ActionUpdated means the object existed and was patched.
+	ActionUpdated Action = "updated"
+	// ActionApplied means the object was sent with server-side apply, which
+	// creates or updates it in a single call.
+	ActionApplied Action = "applied"
+	// ActionUnchanged means the object already matched the manifest and was
+	// left alone.
+	ActionUnchanged Action = "unchanged"
+	// ActionDeleted means the object was deleted.
+	ActionDeleted Action = "deleted"
+	// ActionSkipped means the object was not applied because the cluster
+	// doesn't serve its kind, see Options.SkipUnresolvable, or the
+	// Options.Precondition isn't met. Delete skips objects that only set a
+	// generateName.
+	ActionSkipped Action = "skipped"
+	// ActionReplaced means the object was deleted and created again since
+	// immutable fields changed. See Options.ForceReplace.
+	ActionReplaced Action = "replaced"
+)
+
+// Result describes the outcome for a single object of the manifest.
+type Result struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	// Name is the name of the object, including the name the server
+	// generated for objects created from metadata.generateName.
+	Name   string
+	Action Action
+	// Warnings are the warnings returned by the API server for the object,
+	// eg about a deprecated apiVersion.
+	Warnings []string
+	// NextSchedule is when an applied CronJob runs next. It is nil for other
+	// kinds and for suspended CronJobs.
+	NextSchedule *time.Time
+	// Drift are the fields set by the manifest that the live object didn't
+	// keep, eg because a mutating webhook or a controller changed them. Only
+	// set with Options.VerifyAfterApply, Old is the live value.
+	Drift []FieldChange
+	// UID, ResourceVersion and Generation are those of the object as stored
+	// by the server after the apply, eg to set owner references to it. They
+	// are empty for objects skipped because of Options.StateFile.
+	UID             types.UID
+	ResourceVersion string
+	Generation      int64
+	// ManagedFields are the fields the field manager owns in the object
+	// after a server-side apply, eg spec.containers[name=app].image. Only
+	// set with Options.ReportManagedFields.
+	ManagedFields []string
+}
+
+// identify sets the identity of the object stored by the server.
+func (r *Result) identify(obj *unstructured.Unstructured) {
+	if obj == nil {
+		return
+	}
+	r.UID = obj.GetUID()
+	r.ResourceVersion = obj.GetResourceVersion()
+	r.Generation = obj.GetGeneration()
+}
@@ -0,0 +1,117 @@
+package kedge
+
+import (
+	"fmt"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+// ownerLabel holds the uid of Options.Owner on the objects kedge made its
+// dependents, so ReconcileOwned can find them.
+const ownerLabel = "kedge.io/owner-uid"
+
+// ownerReference returns the owner reference to Options.Owner, getting the
+// owner the first time.
+func (a *applier) ownerReference() (metav1.OwnerReference, error) {
+	if a.owner != nil {
+		return *a.owner, nil
+	}
+	owner := a.opts.Owner
+	client, err := a.clientForResult(Result{APIVersion: owner.APIVersion, Kind: owner.Kind, Namespace: owner.Namespace, Name: owner.Name})
+	if err != nil {
+		return metav1.OwnerReference{}, err
+	}
+	live, err := client.Get(a.context(), owner.Name, metav1.GetOptions{})
+	if err != nil {
+		return metav1.OwnerReference{}, fmt.Errorf("ERROR: could not get owner %s '%s/%s': %w", owner.Kind, owner.Namespace, owner.Name, err)
+	}
+	a.owner = &metav1.OwnerReference{
+		APIVersion: live.GetAPIVersion(),
+		Kind:       live.GetKind(),
+		Name:       live.GetName(),
+		UID:        live.GetUID(),
+	}
+	return *a.owner, nil
+}
+
+// setOwner makes obj a dependent of Options.Owner.
+func (a *applier) setOwner(obj *unstructured.Unstructured) error {
+	ref, err := a.ownerReference()
+	if err != nil {
+		return err
+	}
+	obj.SetOwnerReferences([]metav1.OwnerReference{ref})
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[ownerLabel] = string(ref.UID)
+	obj.SetLabels(labels)
+	return nil
+}
+
+// ReconcileOwned applies the manifest like ApplyWithOptions with every object
+// a dependent of opts.Owner, then deletes the dependents a previous apply
+// made that are no longer part of the manifest. Kubernetes garbage collects
+// all of them once the owner is deleted. Objects the owner's controller made
+// itself are never deleted since they don't carry the kedge.io/owner-uid
+// label. Dependents that are already gone by the time they are deleted get
+// no Result.
+func ReconcileOwned(config *rest.Config, inputFilename, namespace string, valueFilenames []string, opts Options) ([]Result, error) {
+	opts.liveConfig = config
+	if opts.Owner == nil {
+		return nil, fmt.Errorf("ReconcileOwned needs an Owner")
+	}
+	b, namespace, err := renderManifest(inputFilename, namespace, valueFilenames, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	a := newApplier(config, opts).withSource(inputFilename, valueFilenames)
+	if err := a.applyManifest(b, namespace); err != nil {
+		return a.results, err
+	}
+	ref, err := a.ownerReference()
+	if err != nil {
+		return a.results, err
+	}
+	rendered, namespaces, err := a.renderedObjects(b, namespace)
+	if err != nil {
+		return a.results, a.explainError(err)
+	}
+	orphans, err := a.listMissing(ownerLabel+"="+string(ref.UID), namespaces, rendered, false)
+	if err != nil {
+		return a.results, a.explainError(err)
+	}
+
+	ctx := a.context()
+	for _, orphan := range orphans {
+		result := Result{APIVersion: orphan.APIVersion, Kind: orphan.Kind, Namespace: orphan.Namespace, Name: orphan.Name}
+		if err := a.checkGroup(schema.FromAPIVersionAndKind(orphan.APIVersion, orphan.Kind), orphan.Name); err != nil {
+			return a.results, a.explainError(err)
+		}
+		client, err := a.clientForResult(result)
+		if err != nil {
+			return a.results, err
+		}
+		err = client.Delete(ctx, orphan.Name, a.opts.deleteOptions())
+		if err != nil {
+			if !kerrors.IsNotFound(err) {
+				return a.results, a.explainError(fmt.Errorf("ERROR: could not delete %s '%s/%s': %w", orphan.Kind, orphan.Namespace, orphan.Name, err))
+			}
+			// deleted since it was listed, nothing left to report
+			a.logf("%s '%s/%s' does not exist", orphan.Kind, orphan.Namespace, orphan.Name)
+			continue
+		}
+		a.logf("%s '%s/%s' is no longer owned and has been deleted", orphan.Kind, orphan.Namespace, orphan.Name)
+		result.Action = ActionDeleted
+		if err := a.record(result); err != nil {
+			return a.results, err
+		}
+	}
+	return a.results, nil
+}
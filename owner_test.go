@@ -0,0 +1,75 @@
+package kedge
+
+import (
+	"context"
+	"testing"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestReconcileOwnedAllowedGroups(t *testing.T) {
+	owner := &unstructured.Unstructured{}
+	owner.SetAPIVersion("v1")
+	owner.SetKind("ConfigMap")
+	owner.SetNamespace("team")
+	owner.SetName("owner")
+	owner.SetUID(types.UID("3f2a"))
+	orphan := &unstructured.Unstructured{}
+	orphan.SetAPIVersion("apps/v1")
+	orphan.SetKind("Deployment")
+	orphan.SetNamespace("team")
+	orphan.SetName("app")
+	orphan.SetLabels(map[string]string{ownerLabel: "3f2a"})
+	cluster, client := newTestCluster(owner, orphan)
+
+	opts := Options{
+		Cluster:       cluster,
+		Owner:         &ObjectRef{APIVersion: "v1", Kind: "ConfigMap", Namespace: "team", Name: "owner"},
+		AllowedGroups: []string{""},
+	}
+	if _, err := ReconcileOwned(nil, writeManifest(t, settingsManifest), "team", nil, opts); err == nil {
+		t.Fatal("got no error, want the Deployment rejected")
+	}
+	if _, err := client.Resource(deploymentResource).Namespace("team").Get(context.Background(), "app", metav1.GetOptions{}); err != nil {
+		t.Errorf("got %v, want the Deployment kept", err)
+	}
+}
+
+func TestReconcileOwnedAlreadyDeleted(t *testing.T) {
+	owner := &unstructured.Unstructured{}
+	owner.SetAPIVersion("v1")
+	owner.SetKind("ConfigMap")
+	owner.SetNamespace("team")
+	owner.SetName("owner")
+	owner.SetUID(types.UID("3f2a"))
+	orphan := &unstructured.Unstructured{}
+	orphan.SetAPIVersion("apps/v1")
+	orphan.SetKind("Deployment")
+	orphan.SetNamespace("team")
+	orphan.SetName("app")
+	orphan.SetLabels(map[string]string{ownerLabel: "3f2a"})
+	cluster, client := newTestCluster(owner, orphan)
+	// someone else deletes the Deployment between the list and the delete
+	client.PrependReactor("delete", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, kerrors.NewNotFound(deploymentResource.GroupResource(), "app")
+	})
+
+	opts := Options{
+		Cluster: cluster,
+		Owner:   &ObjectRef{APIVersion: "v1", Kind: "ConfigMap", Namespace: "team", Name: "owner"},
+	}
+	results, err := ReconcileOwned(nil, writeManifest(t, settingsManifest), "team", nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Kind == "Deployment" {
+			t.Errorf("got %v, want no result for the Deployment that was already gone", result)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package kedge
+
+import (
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// ApplyJSONPatch applies a JSON Patch (RFC 6902) document to an existing
+// object, eg
+//
+//	[{"op": "replace", "path": "/spec/replicas", "value": 3}]
+//
+// This is meant for precise edits of objects that kedge does not otherwise
+// manage. namespace is ignored for cluster scoped kinds.
+func ApplyJSONPatch(config *rest.Config, gvk schema.GroupVersionKind, namespace, name string, patch []byte) error {
+	return ApplyJSONPatchWithOptions(config, gvk, namespace, name, patch, Options{})
+}
+
+// ApplyJSONPatchWithOptions is ApplyJSONPatch using opts, eg to log to
+// Options.Logger or to restrict the AllowedGroups.
+func ApplyJSONPatchWithOptions(config *rest.Config, gvk schema.GroupVersionKind, namespace, name string, patch []byte, opts Options) error {
+	ops := []map[string]interface{}{}
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return fmt.Errorf("the patch is not a JSON Patch document: %s", err)
+	}
+
+	a := newApplier(config, opts)
+	if err := a.checkGroup(gvk, name); err != nil {
+		return err
+	}
+	namespaceableResourceClient, isNamespaced, err := a.namespaceableClient(gvk)
+	if err != nil {
+		return fmt.Errorf("ERROR: could not get a client to handle resource: %w", err)
+	}
+	var dynamicClient dynamic.ResourceInterface = namespaceableResourceClient
+	if isNamespaced {
+		dynamicClient = namespaceableResourceClient.Namespace(namespace)
+	} else {
+		namespace = ""
+	}
+
+	_, err = dynamicClient.Patch(a.context(), name, types.JSONPatchType, patch, metav1.PatchOptions{FieldManager: opts.fieldManager(gvk.Kind)})
+	if err != nil {
+		return a.explainError(fmt.Errorf("ERROR: could not patch %s '%s/%s': %w", gvk.Kind, namespace, name, err))
+	}
+	a.logf("%s '%s/%s' has been patched", gvk.Kind, namespace, name)
+	return nil
+}
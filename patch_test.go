@@ -0,0 +1,74 @@
+package kedge
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+// captureStdLog returns what the log package logs until the test ends.
+func captureStdLog(t *testing.T) *bytes.Buffer {
+	var std bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&std)
+	t.Cleanup(func() { log.SetOutput(previous) })
+	return &std
+}
+
+func TestApplyJSONPatchLogger(t *testing.T) {
+	std := captureStdLog(t)
+	settings := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "settings", "namespace": "team"},
+		"data":       map[string]interface{}{"level": "info"},
+	}}
+	cluster, client := newTestCluster(settings)
+	logger := &recordingLogger{}
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	patch := []byte(`[{"op": "replace", "path": "/data/level", "value": "debug"}]`)
+	if err := ApplyJSONPatchWithOptions(nil, gvk, "team", "settings", patch, Options{Cluster: cluster, Logger: logger}); err != nil {
+		t.Fatal(err)
+	}
+	live, err := client.Resource(configMapResource).Namespace("team").Get(context.Background(), "settings", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level, _, _ := unstructured.NestedString(live.Object, "data", "level"); level != "debug" {
+		t.Errorf("got level %q, want debug", level)
+	}
+	if len(logger.lines) != 1 || logger.lines[0] != "ConfigMap 'team/settings' has been patched" {
+		t.Errorf("got %q logged, want the patch", logger.lines)
+	}
+	if std.Len() > 0 {
+		t.Errorf("got %q logged by the log package, want nothing", std.String())
+	}
+}
+
+func TestDiscoveryLogger(t *testing.T) {
+	std := captureStdLog(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	logger := &recordingLogger{}
+	config := &rest.Config{Host: server.URL}
+	if _, err := ApplyWithOptions(config, writeManifest(t, settingsManifest), "team", nil, Options{Logger: logger}); err == nil {
+		t.Fatal("got no error, want discovery to fail")
+	}
+	if len(logger.lines) == 0 {
+		t.Error("got nothing logged, want the discovery errors")
+	}
+	if std.Len() > 0 {
+		t.Errorf("got %q logged by the log package, want nothing", std.String())
+	}
+}
@@ -0,0 +1,172 @@
+package kedge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// PlannedAction is what an apply would do with a single object.
+type PlannedAction struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	// Action is ActionCreated, ActionUpdated, ActionUnchanged or, with
+	// Options.ForceReplace, ActionReplaced
+	Action Action
+}
+
+// Plan renders the manifest like Apply and reports, for each object, whether
+// an apply would create it, update it or leave it unchanged. Nothing is
+// changed in the cluster: existing objects get the same patch as Apply sends
+// in a server-side dry run and the result is compared with the live object,
+// so defaulting, admission webhooks and the fields a ThreeWayMerge removes
+// are accounted for.
+func Plan(config *rest.Config, inputFilename, namespace string, valueFilenames []string) ([]PlannedAction, error) {
+	return PlanWithOptions(config, inputFilename, namespace, valueFilenames, Options{})
+}
+
+// PlanWithOptions is Plan using opts.
+func PlanWithOptions(config *rest.Config, inputFilename, namespace string, valueFilenames []string, opts Options) ([]PlannedAction, error) {
+	opts.liveConfig = config
+	b, namespace, err := renderManifest(inputFilename, namespace, valueFilenames, opts)
+	if err != nil {
+		return nil, err
+	}
+	a := newApplier(config, opts).withSource(inputFilename, valueFilenames)
+	docs := splitDocuments(b)
+	if opts.InstallOrder {
+		sortByInstallOrder(docs)
+	}
+	a.prefetchDiscovery(docs)
+	plan := []PlannedAction{}
+	for _, doc := range docs {
+		objs, err := decodeObjects(doc)
+		if err != nil {
+			return plan, err
+		}
+		for _, obj := range objs {
+			action, err := a.planObject(obj, namespace)
+			if err != nil {
+				return plan, a.explainError(err)
+			}
+			plan = append(plan, action)
+		}
+	}
+	return plan, nil
+}
+
+func (a *applier) planObject(obj *unstructured.Unstructured, namespace string) (PlannedAction, error) {
+	ctx := a.context()
+	client, namespace, err := a.prepareObject(obj, namespace)
+	if err != nil {
+		return PlannedAction{}, err
+	}
+	unnamed, err := a.unnamed(ctx, client, obj, namespace)
+	if err != nil {
+		return PlannedAction{}, err
+	}
+	action := PlannedAction{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  namespace,
+		Name:       obj.GetName(),
+	}
+	if unnamed {
+		action.Action = ActionCreated
+		return action, nil
+	}
+
+	live, err := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			action.Action = ActionCreated
+			return action, nil
+		}
+		return action, fmt.Errorf("ERROR: could not get %s '%s/%s': %w", action.Kind, namespace, action.Name, err)
+	}
+	if a.opts.CheckImmutable || a.opts.ForceReplace {
+		replace, err := a.checkImmutable(obj, live)
+		if err != nil {
+			return action, err
+		}
+		if replace {
+			action.Action = ActionReplaced
+			return action, nil
+		}
+	}
+
+	dryRun, err := a.dryRunUpdate(ctx, client, obj, live)
+	if err != nil {
+		return action, err
+	}
+	if reflect.DeepEqual(withoutServerFields(live).Object, withoutServerFields(dryRun).Object) {
+		action.Action = ActionUnchanged
+	} else {
+		action.Action = ActionUpdated
+	}
+	return action, nil
+}
+
+// dryRunUpdate sends the update an apply would send for obj in dry run mode
+// and returns the object the server would have stored. Without server-side
+// apply this is the same patch as applyObject, so a 3-way merge also removes
+// the fields dropped from the manifest.
+func (a *applier) dryRunUpdate(ctx context.Context, client dynamic.ResourceInterface, obj, live *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if a.opts.ServerSideApply {
+		return a.dryRunApply(ctx, client, obj)
+	}
+	if a.opts.ThreeWayMerge {
+		obj = obj.DeepCopy()
+		if err := setLastApplied(obj); err != nil {
+			return nil, err
+		}
+	}
+	patchType, b, err := a.updatePatch(obj, live)
+	if err != nil {
+		return nil, err
+	}
+	if string(b) == "{}" {
+		return live, nil
+	}
+	dryRun, err := client.Patch(ctx, obj.GetName(), patchType, b, metav1.PatchOptions{
+		FieldValidation: a.opts.fieldValidation(),
+		DryRun:          []string{metav1.DryRunAll},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: could not dry run patch of %s '%s/%s': %w", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+	}
+	return dryRun, nil
+}
+
+// dryRunApply sends obj as a server-side apply patch in dry run mode and
+// returns the object the server would have stored, after defaulting and
+// admission webhooks.
+func (a *applier) dryRunApply(ctx context.Context, client dynamic.ResourceInterface, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	b, err := json.Marshal(obj.Object)
+	if err != nil {
+		return nil, err
+	}
+	dryRun, err := client.Patch(ctx, obj.GetName(), types.ApplyPatchType, b, metav1.PatchOptions{
+		FieldManager:    a.opts.fieldManager(obj.GetKind()),
+		FieldValidation: a.opts.fieldValidation(),
+		Force:           &a.opts.ForceConflicts,
+		DryRun:          []string{metav1.DryRunAll},
+	})
+	if err != nil {
+		if conflictErr := newConflictError(err, obj.GetKind(), obj.GetNamespace(), obj.GetName()); conflictErr != nil {
+			return nil, conflictErr
+		}
+		return nil, fmt.Errorf("ERROR: could not dry run apply of %s '%s/%s': %w", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+	}
+	return dryRun, nil
+}
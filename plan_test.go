@@ -0,0 +1,74 @@
+package kedge
+
+import (
+	"encoding/json"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestPlanGenerateName(t *testing.T) {
+	cluster, client := newTestCluster()
+	manifest := writeManifest(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  generateName: settings-\n")
+	plan, err := PlanWithOptions(nil, manifest, "team", nil, Options{Cluster: cluster})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 1 || plan[0].Action != ActionCreated {
+		t.Fatalf("got %v, want the ConfigMap created", plan)
+	}
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "get" {
+			t.Errorf("got a get of %s, want none for a generateName object", action.GetResource().Resource)
+		}
+	}
+}
+
+func TestPlanThreeWayMerge(t *testing.T) {
+	live := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      "settings",
+			"namespace": "team",
+			"annotations": map[string]interface{}{
+				lastAppliedAnnotation: `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings","namespace":"team"},"data":{"color":"blue","size":"large"}}`,
+			},
+		},
+		"data": map[string]interface{}{"color": "blue", "size": "large"},
+	}}
+	cluster, client := newTestCluster(live)
+	client.PrependReactor("patch", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		current, err := json.Marshal(live.Object)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := strategicpatch.StrategicMergePatch(current, patch.GetPatch(), &corev1.ConfigMap{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dryRun := &unstructured.Unstructured{}
+		return true, dryRun, dryRun.UnmarshalJSON(b)
+	})
+	manifest := writeManifest(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\ndata:\n  color: blue\n")
+
+	plan, err := PlanWithOptions(nil, manifest, "team", nil, Options{Cluster: cluster})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 1 || plan[0].Action != ActionUnchanged {
+		t.Fatalf("got %v, want the ConfigMap unchanged without ThreeWayMerge", plan)
+	}
+	plan, err = PlanWithOptions(nil, manifest, "team", nil, Options{Cluster: cluster, ThreeWayMerge: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 1 || plan[0].Action != ActionUpdated {
+		t.Fatalf("got %v, want the ConfigMap updated to remove size", plan)
+	}
+}
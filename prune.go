@@ -0,0 +1,149 @@
+package kedge
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// ObjectRef identifies an object in a cluster.
+type ObjectRef struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+}
+
+// notPrunable are the resources the cluster manages itself, which may carry
+// the labels of the objects they are created for.
+var notPrunable = map[string]bool{
+	"endpoints": true,
+	"events":    true,
+}
+
+// PlanPrune renders the manifest like Apply and returns the live objects
+// matching the releaseLabel selector, eg `app.kubernetes.io/instance=web`,
+// that are no longer part of it. Nothing is deleted.
+//
+// Every kind the cluster can list is searched, in the namespaces of the
+// rendered objects for namespaced kinds. Objects with owner references are
+// left out since they go away with their owner.
+func PlanPrune(config *rest.Config, inputFilename, namespace, releaseLabel string, valueFilenames []string) ([]ObjectRef, error) {
+	return PlanPruneWithOptions(config, inputFilename, namespace, releaseLabel, valueFilenames, Options{})
+}
+
+// PlanPruneWithOptions is PlanPrune using opts.
+func PlanPruneWithOptions(config *rest.Config, inputFilename, namespace, releaseLabel string, valueFilenames []string, opts Options) ([]ObjectRef, error) {
+	opts.liveConfig = config
+	if _, err := metav1.ParseToLabelSelector(releaseLabel); err != nil || releaseLabel == "" {
+		return nil, fmt.Errorf("invalid release label selector '%s'", releaseLabel)
+	}
+	b, namespace, err := renderManifest(inputFilename, namespace, valueFilenames, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	a := newApplier(config, opts)
+	rendered, namespaces, err := a.renderedObjects(b, namespace)
+	if err != nil {
+		return nil, a.explainError(err)
+	}
+	refs, err := a.listMissing(releaseLabel, namespaces, rendered, true)
+	return refs, a.explainError(err)
+}
+
+// renderedObjects returns the keys of the objects of a rendered manifest,
+// see pruneKey, along with the namespaces they are in.
+func (a *applier) renderedObjects(b []byte, namespace string) (map[string]bool, map[string]bool, error) {
+	rendered := map[string]bool{}
+	namespaces := map[string]bool{namespace: true}
+	for _, doc := range splitDocuments(b) {
+		objs, err := decodeObjects(doc)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, obj := range objs {
+			_, ns, err := a.resourceClient(obj, namespace)
+			if err != nil {
+				return nil, nil, err
+			}
+			if ns != "" {
+				namespaces[ns] = true
+			}
+			rendered[pruneKey(obj.GroupVersionKind().GroupKind(), ns, obj.GetName())] = true
+		}
+	}
+	return rendered, namespaces, nil
+}
+
+// listMissing returns the live objects matching selector that are not in
+// rendered. Namespaced kinds are only listed in namespaces. Objects with
+// owner references are left out when skipOwned is set.
+func (a *applier) listMissing(selector string, namespaces, rendered map[string]bool, skipOwned bool) ([]ObjectRef, error) {
+	resources, err := a.cluster.PreferredResources()
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := a.cluster.Dynamic()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := a.context()
+	refs := []ObjectRef{}
+	for _, resource := range resources {
+		gv := schema.GroupVersion{Group: resource.Group, Version: resource.Version}
+		if strings.Contains(resource.Name, "/") || notPrunable[resource.Name] || !hasVerbs(resource, "list", "delete") {
+			continue
+		}
+		client := dynamicClient.Resource(gv.WithResource(resource.Name))
+		var clients []dynamic.ResourceInterface
+		if resource.Namespaced {
+			for ns := range namespaces {
+				clients = append(clients, client.Namespace(ns))
+			}
+		} else {
+			clients = append(clients, client)
+		}
+		for _, c := range clients {
+			list, err := c.List(ctx, metav1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				return nil, fmt.Errorf("ERROR: could not list %s: %w", resource.Name, err)
+			}
+			for _, item := range list.Items {
+				if skipOwned && len(item.GetOwnerReferences()) > 0 {
+					continue
+				}
+				gk := schema.GroupKind{Group: gv.Group, Kind: resource.Kind}
+				if rendered[pruneKey(gk, item.GetNamespace(), item.GetName())] {
+					continue
+				}
+				refs = append(refs, ObjectRef{
+					APIVersion: gv.String(),
+					Kind:       resource.Kind,
+					Namespace:  item.GetNamespace(),
+					Name:       item.GetName(),
+				})
+			}
+		}
+	}
+	return refs, nil
+}
+
+// pruneKey identifies an object regardless of the version it is served as.
+func pruneKey(gk schema.GroupKind, namespace, name string) string {
+	return gk.String() + "/" + namespace + "/" + name
+}
+
+func hasVerbs(resource metav1.APIResource, verbs ...string) bool {
+	for _, verb := range verbs {
+		if !contains(resource.Verbs, verb) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,186 @@
+package kedge
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	redacted       = "***"
+	redactedBefore = "*** (before)"
+	redactedAfter  = "*** (after)"
+)
+
+// secretPaths are always redacted from Secrets.
+var secretPaths = []string{"data", "stringData"}
+
+// redactPaths returns the field paths to redact from objects of kind, split
+// on dots.
+func (o Options) redactPaths(kind string) [][]string {
+	paths := [][]string{}
+	if kind == "Secret" {
+		for _, path := range secretPaths {
+			paths = append(paths, strings.Split(path, "."))
+		}
+	}
+	for _, path := range o.RedactPaths[kind] {
+		paths = append(paths, strings.Split(path, "."))
+	}
+	return paths
+}
+
+// RedactManifest returns a copy of a rendered manifest that is safe to
+// display, with the values of Secrets and of opts.RedactPaths masked.
+func RedactManifest(manifest []byte, opts Options) ([]byte, error) {
+	out := bytes.NewBuffer([]byte{})
+	for _, doc := range splitDocuments(manifest) {
+		objs, err := decodeObjects(doc)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			b, err := yaml.Marshal(redactObject(obj, opts).Object)
+			if err != nil {
+				return nil, err
+			}
+			out.WriteString("---\n")
+			out.Write(b)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// redactObject returns a copy of obj with every redacted value masked. The
+// copy is only meant for display, obj itself is left untouched.
+func redactObject(obj *unstructured.Unstructured, opts Options) *unstructured.Unstructured {
+	obj = obj.DeepCopy()
+	paths := opts.redactPaths(obj.GetKind())
+	for _, path := range paths {
+		v, found, _ := unstructured.NestedFieldNoCopy(obj.Object, path...)
+		if found {
+			unstructured.SetNestedField(obj.Object, maskValue(v, redacted), path...)
+		}
+	}
+	if len(paths) > 0 {
+		redactLastApplied(obj, opts)
+	}
+	return obj
+}
+
+// redactLastApplied masks the redacted values in the copy of the object
+// held by the last applied annotation of obj, which would show them
+// otherwise. The annotation is masked entirely if it can't be decoded.
+func redactLastApplied(obj *unstructured.Unstructured, opts Options) {
+	annotations := obj.GetAnnotations()
+	lastApplied, ok := annotations[lastAppliedAnnotation]
+	if !ok {
+		return
+	}
+	applied := &unstructured.Unstructured{}
+	if err := applied.UnmarshalJSON([]byte(lastApplied)); err != nil {
+		annotations[lastAppliedAnnotation] = redacted
+		obj.SetAnnotations(annotations)
+		return
+	}
+	b, err := redactObject(applied, opts).MarshalJSON()
+	if err != nil {
+		annotations[lastAppliedAnnotation] = redacted
+	} else {
+		annotations[lastAppliedAnnotation] = strings.TrimSpace(string(b))
+	}
+	obj.SetAnnotations(annotations)
+}
+
+// redactPair masks the redacted values of desired and live, copies of both
+// are returned. Values that differ are masked with "*** (before)" and
+// "*** (after)" so a diff of the two still shows that they changed.
+func redactPair(desired, live *unstructured.Unstructured, opts Options) (*unstructured.Unstructured, *unstructured.Unstructured) {
+	desired = desired.DeepCopy()
+	live = live.DeepCopy()
+	paths := opts.redactPaths(desired.GetKind())
+	if len(paths) > 0 {
+		// the annotation holds the values of the last apply
+		redactLastApplied(desired, opts)
+		redactLastApplied(live, opts)
+	}
+	for _, path := range paths {
+		d, dFound, _ := unstructured.NestedFieldNoCopy(desired.Object, path...)
+		l, lFound, _ := unstructured.NestedFieldNoCopy(live.Object, path...)
+		if !dFound && !lFound {
+			continue
+		}
+		d, l = maskPair(d, l)
+		if dFound {
+			unstructured.SetNestedField(desired.Object, d, path...)
+		}
+		if lFound {
+			unstructured.SetNestedField(live.Object, l, path...)
+		}
+	}
+	return desired, live
+}
+
+// isRedacted reports whether the field path, as used by FieldChange, is
+// redacted for kind.
+func (o Options) isRedacted(kind, path string) bool {
+	paths := o.redactPaths(kind)
+	if len(paths) > 0 && path == joinPath("metadata.annotations", lastAppliedAnnotation) {
+		return true
+	}
+	for _, p := range paths {
+		prefix := strings.Join(p, ".")
+		if path == prefix || strings.HasPrefix(path, prefix+".") || strings.HasPrefix(path, prefix+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+func maskValue(v interface{}, mask string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = maskValue(item, mask)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, item := range v {
+			s[i] = maskValue(item, mask)
+		}
+		return s
+	default:
+		return mask
+	}
+}
+
+func maskPair(d, l interface{}) (interface{}, interface{}) {
+	dm, dOk := d.(map[string]interface{})
+	lm, lOk := l.(map[string]interface{})
+	if dOk && lOk {
+		dOut := make(map[string]interface{}, len(dm))
+		lOut := make(map[string]interface{}, len(lm))
+		for k, dv := range dm {
+			if lv, ok := lm[k]; ok {
+				dOut[k], lOut[k] = maskPair(dv, lv)
+			} else {
+				dOut[k] = maskValue(dv, redactedAfter)
+			}
+		}
+		for k, lv := range lm {
+			if _, ok := dm[k]; !ok {
+				lOut[k] = maskValue(lv, redactedBefore)
+			}
+		}
+		return dOut, lOut
+	}
+	if reflect.DeepEqual(d, l) {
+		return maskValue(d, redacted), maskValue(l, redacted)
+	}
+	return maskValue(d, redactedAfter), maskValue(l, redactedBefore)
+}
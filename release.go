@@ -0,0 +1,351 @@
+package kedge
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// releaseNameLabel and revisionLabel identify the Secrets holding the
+	// revisions of a release.
+	releaseNameLabel = "kedge.io/release"
+	revisionLabel    = "kedge.io/revision"
+
+	// releaseSecretType is the type of the Secrets of release revisions.
+	releaseSecretType = "kedge.io/release.v1"
+	// releaseKey is the key of the Secret data holding the gzipped JSON of
+	// the Release.
+	releaseKey = "release"
+)
+
+var secretResource = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+// Release statuses.
+const (
+	ReleaseDeployed = "deployed"
+	ReleaseFailed   = "failed"
+)
+
+// Release is a recorded revision of a release, see Options.RecordRelease.
+type Release struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// Revision counts the applies of the release from 1.
+	Revision int       `json:"revision"`
+	Time     time.Time `json:"time"`
+	// Status is ReleaseDeployed, or ReleaseFailed with the Error of the
+	// apply.
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Source is the template and ValueFiles the value files rendered.
+	Source     string   `json:"source"`
+	ValueFiles []string `json:"valueFiles,omitempty"`
+	// Values are the values the template was rendered with.
+	Values map[string]interface{} `json:"values,omitempty"`
+	// Manifest is the rendered manifest that was applied.
+	Manifest string `json:"manifest"`
+	// RollbackTo is the revision this one rolled back to, see Rollback.
+	RollbackTo int `json:"rollbackTo,omitempty"`
+	// Options are the options the manifest was applied with that change
+	// which objects are applied and how.
+	Options ReleaseOptions `json:"options"`
+}
+
+// ReleaseOptions are the options of an apply recorded with its release, so
+// that Rollback applies the same objects again, eg with the same
+// NamePrefix. Options that can't be recorded, like Transformers, Owner or
+// Impersonate, have to be passed to RollbackWithOptions.
+type ReleaseOptions struct {
+	NamePrefix            string            `json:"namePrefix,omitempty"`
+	NameSuffix            string            `json:"nameSuffix,omitempty"`
+	ForceNamespace        bool              `json:"forceNamespace,omitempty"`
+	Labels                map[string]string `json:"labels,omitempty"`
+	Annotations           map[string]string `json:"annotations,omitempty"`
+	CreateOnlyLabels      map[string]string `json:"createOnlyLabels,omitempty"`
+	CreateOnlyAnnotations map[string]string `json:"createOnlyAnnotations,omitempty"`
+	ServerSideApply       bool              `json:"serverSideApply,omitempty"`
+	FieldManager          string            `json:"fieldManager,omitempty"`
+	FieldManagers         map[string]string `json:"fieldManagers,omitempty"`
+	// AllowedGroups is null when every group is allowed.
+	AllowedGroups []string `json:"allowedGroups"`
+}
+
+// releaseOptions returns the recorded options of opts.
+func releaseOptions(opts Options) ReleaseOptions {
+	return ReleaseOptions{
+		NamePrefix:            opts.NamePrefix,
+		NameSuffix:            opts.NameSuffix,
+		ForceNamespace:        opts.ForceNamespace,
+		Labels:                opts.Labels,
+		Annotations:           opts.Annotations,
+		CreateOnlyLabels:      opts.CreateOnlyLabels,
+		CreateOnlyAnnotations: opts.CreateOnlyAnnotations,
+		ServerSideApply:       opts.ServerSideApply,
+		FieldManager:          opts.FieldManager,
+		FieldManagers:         opts.FieldManagers,
+		AllowedGroups:         opts.AllowedGroups,
+	}
+}
+
+// withOptions returns opts with the recorded options r.
+func (r ReleaseOptions) withOptions(opts Options) Options {
+	opts.NamePrefix = r.NamePrefix
+	opts.NameSuffix = r.NameSuffix
+	opts.ForceNamespace = r.ForceNamespace
+	opts.Labels = r.Labels
+	opts.Annotations = r.Annotations
+	opts.CreateOnlyLabels = r.CreateOnlyLabels
+	opts.CreateOnlyAnnotations = r.CreateOnlyAnnotations
+	opts.ServerSideApply = r.ServerSideApply
+	opts.FieldManager = r.FieldManager
+	opts.FieldManagers = r.FieldManagers
+	opts.AllowedGroups = r.AllowedGroups
+	return opts
+}
+
+// ListReleases returns the revisions of the release called name in
+// namespace, oldest first. The same name can be released in several
+// namespaces, eg with ApplyToNamespaces, each with its own revisions.
+func ListReleases(config *rest.Config, namespace, name string) ([]Release, error) {
+	return newApplier(config, Options{}).listReleases(namespace, name)
+}
+
+// GetRelease returns the revision of the release called name in namespace.
+func GetRelease(config *rest.Config, namespace, name string, revision int) (*Release, error) {
+	releases, err := ListReleases(config, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range releases {
+		if releases[i].Revision == revision {
+			return &releases[i], nil
+		}
+	}
+	return nil, fmt.Errorf("release '%s/%s' has no revision %d", namespace, name, revision)
+}
+
+// Rollback applies the manifest of a revision of the release called name in
+// namespace again, with the ReleaseOptions it was applied with, and deletes the
+// objects of the latest revision it doesn't have. The rollback is recorded
+// as a new revision, with RollbackTo set to revision.
+func Rollback(config *rest.Config, namespace, name string, revision int) error {
+	_, err := RollbackWithOptions(config, namespace, name, revision, Options{})
+	return err
+}
+
+// RollbackWithOptions is Rollback using opts. The recorded ReleaseOptions of
+// each revision override those of opts.
+func RollbackWithOptions(config *rest.Config, namespace, name string, revision int, opts Options) ([]Result, error) {
+	releases, err := newApplier(config, opts).listReleases(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	var target *Release
+	for i := range releases {
+		if releases[i].Revision == revision {
+			target = &releases[i]
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("release '%s/%s' has no revision %d", namespace, name, revision)
+	}
+	latest := &releases[len(releases)-1]
+
+	a := newApplier(config, target.Options.withOptions(opts))
+	err = a.applyManifest([]byte(target.Manifest), target.Namespace)
+	if err == nil && latest.Revision != target.Revision {
+		// the objects of the latest revision are named with its own options
+		current := newApplier(config, latest.Options.withOptions(opts))
+		err = a.explainError(a.pruneRelease(current, latest, target))
+	}
+	rollback := *target
+	rollback.Error = ""
+	rollback.RollbackTo = revision
+	if recordErr := a.recordRelease(&rollback, err); recordErr != nil && err == nil {
+		err = recordErr
+	}
+	return a.results, err
+}
+
+// pruneRelease deletes the objects of the current revision that the target
+// revision, which a applied, doesn't have. currentApplier resolves the
+// objects of the current revision.
+func (a *applier) pruneRelease(currentApplier *applier, current, target *Release) error {
+	kept, _, err := a.renderedObjects([]byte(target.Manifest), target.Namespace)
+	if err != nil {
+		return err
+	}
+	ctx := a.context()
+	for _, doc := range splitDocuments([]byte(current.Manifest)) {
+		objs, err := decodeObjects(doc)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			client, ns, err := currentApplier.resourceClient(obj, current.Namespace)
+			if err != nil {
+				return err
+			}
+			if obj.GetName() == "" || kept[pruneKey(obj.GroupVersionKind().GroupKind(), ns, obj.GetName())] {
+				continue
+			}
+			if err := a.checkGroup(obj.GroupVersionKind(), obj.GetName()); err != nil {
+				return err
+			}
+			err = client.Delete(ctx, obj.GetName(), a.opts.deleteOptions())
+			if kerrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("ERROR: could not delete %s '%s/%s': %w", obj.GetKind(), ns, obj.GetName(), err)
+			}
+			a.logf("%s '%s/%s' is not in revision %d and has been deleted", obj.GetKind(), ns, obj.GetName(), target.Revision)
+			if err := a.record(Result{
+				APIVersion: obj.GetAPIVersion(),
+				Kind:       obj.GetKind(),
+				Namespace:  ns,
+				Name:       obj.GetName(),
+				Action:     ActionDeleted,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// listReleases finds the revisions of a release in namespace, which is where
+// they are recorded. Only the Secrets of namespace are listed so no
+// cluster-wide access is needed.
+func (a *applier) listReleases(namespace, name string) ([]Release, error) {
+	client, err := a.cluster.Dynamic()
+	if err != nil {
+		return nil, err
+	}
+	list, err := client.Resource(secretResource).Namespace(namespace).List(a.context(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", releaseNameLabel, name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: could not list the revisions of release '%s/%s': %w", namespace, name, err)
+	}
+	releases := []Release{}
+	for _, item := range list.Items {
+		secret := corev1.Secret{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &secret); err != nil {
+			return nil, fmt.Errorf("could not decode release Secret '%s/%s': %s", item.GetNamespace(), item.GetName(), err)
+		}
+		if secret.Type != releaseSecretType {
+			continue
+		}
+		release, err := decodeRelease(secret.Data[releaseKey])
+		if err != nil {
+			return nil, fmt.Errorf("could not decode release Secret '%s/%s': %s", secret.Namespace, secret.Name, err)
+		}
+		releases = append(releases, *release)
+	}
+	sort.Slice(releases, func(i, j int) bool { return releases[i].Revision < releases[j].Revision })
+	return releases, nil
+}
+
+// recordRelease stores release as the next revision, with the outcome of
+// the apply, applyErr.
+func (a *applier) recordRelease(release *Release, applyErr error) error {
+	client, err := a.cluster.Dynamic()
+	if err != nil {
+		return err
+	}
+	previous, err := a.listReleases(release.Namespace, release.Name)
+	if err != nil {
+		return err
+	}
+	release.Revision = 1
+	if len(previous) > 0 {
+		release.Revision = previous[len(previous)-1].Revision + 1
+	}
+	release.Time = time.Now().UTC()
+	release.Status = ReleaseDeployed
+	if applyErr != nil {
+		release.Status = ReleaseFailed
+		release.Error = applyErr.Error()
+	}
+
+	data, err := encodeRelease(release)
+	if err != nil {
+		return fmt.Errorf("could not encode release '%s': %s", release.Name, err)
+	}
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: releaseSecretName(release.Name, release.Revision),
+			Labels: map[string]string{
+				releaseNameLabel: release.Name,
+				revisionLabel:    strconv.Itoa(release.Revision),
+			},
+		},
+		Type: releaseSecretType,
+		Data: map[string][]byte{releaseKey: data},
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(secret)
+	if err != nil {
+		return fmt.Errorf("could not encode release '%s': %s", release.Name, err)
+	}
+	_, err = client.Resource(secretResource).Namespace(release.Namespace).Create(a.context(), &unstructured.Unstructured{Object: content}, metav1.CreateOptions{FieldManager: a.opts.fieldManager("Secret")})
+	if err != nil {
+		return fmt.Errorf("ERROR: could not create Secret '%s/%s': %w", release.Namespace, secret.Name, err)
+	}
+	a.logf("release '%s' revision %d has been recorded", release.Name, release.Revision)
+	return nil
+}
+
+func releaseSecretName(name string, revision int) string {
+	name = strings.ReplaceAll(strings.ToLower(name), "_", "-")
+	return fmt.Sprintf("kedge.release.%s.v%d", name, revision)
+}
+
+func encodeRelease(release *Release) ([]byte, error) {
+	b, err := json.Marshal(release)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeRelease(data []byte) (*Release, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	release := &Release{}
+	if err := json.Unmarshal(b, release); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
@@ -0,0 +1,61 @@
+package kedge
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRollbackAllowedGroups(t *testing.T) {
+	cluster, client := newTestCluster()
+	// updates are strategic merge patches, which the fake can't apply
+	recordPatches(t, client)
+	values := writeManifest(t, "level: debug\n")
+	opts := Options{Cluster: cluster, RecordRelease: true, ReleaseName: "web", AllowedGroups: []string{""}}
+	manifest := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\ndata:\n  level: \"{{ .level }}\"\n"
+	if _, err := ApplyWithOptions(nil, writeManifest(t, manifest), "team", []string{values}, opts); err != nil {
+		t.Fatal(err)
+	}
+	opts.AllowedGroups = nil
+	if _, err := ApplyWithOptions(nil, writeManifest(t, testBundle), "team", []string{values}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// revision 1 only allows the core group, so rolling back to it can't
+	// prune the Deployment of revision 2
+	if _, err := RollbackWithOptions(nil, "team", "web", 1, Options{Cluster: cluster}); err == nil {
+		t.Fatal("got no error, want the Deployment rejected")
+	}
+	if _, err := client.Resource(deploymentResource).Namespace("team").Get(context.Background(), "app", metav1.GetOptions{}); err != nil {
+		t.Errorf("got %v, want the Deployment kept", err)
+	}
+}
+
+func TestReleasesPerNamespace(t *testing.T) {
+	cluster, client := newTestCluster()
+	recordPatches(t, client)
+	manifest := writeManifest(t, settingsManifest)
+	opts := Options{Cluster: cluster, RecordRelease: true, ReleaseName: "web"}
+	for _, namespace := range []string{"team", "team", "other"} {
+		if _, err := ApplyWithOptions(nil, manifest, namespace, nil, opts); err != nil {
+			t.Fatalf("%s: %s", namespace, err)
+		}
+	}
+
+	a := newApplier(nil, opts)
+	for namespace, want := range map[string]int{"team": 2, "other": 1} {
+		releases, err := a.listReleases(namespace, "web")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(releases) != want {
+			t.Errorf("%s: got %d revisions, want %d", namespace, len(releases), want)
+		}
+		for i, release := range releases {
+			if release.Namespace != namespace || release.Revision != i+1 {
+				t.Errorf("%s: got revision %d of '%s', want revision %d", namespace, release.Revision, release.Namespace, i+1)
+			}
+		}
+	}
+}
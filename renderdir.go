@@ -0,0 +1,60 @@
+package kedge
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// RenderToDir renders the manifest like Apply without a cluster and writes
+// every object to its own file in outDir, named after its kind and name, eg
+// deployment-web.yaml. This lets another tool, like Argo CD or Flux, apply
+// what kedge rendered. Objects are written as rendered: those without a
+// namespace don't get one since there is no cluster to tell which kinds are
+// namespaced.
+func RenderToDir(inputFilename, namespace string, valueFilenames []string, outDir string) error {
+	return RenderToDirWithOptions(inputFilename, namespace, valueFilenames, outDir, Options{})
+}
+
+// RenderToDirWithOptions is RenderToDir using opts.
+func RenderToDirWithOptions(inputFilename, namespace string, valueFilenames []string, outDir string, opts Options) error {
+	b, _, err := renderManifest(inputFilename, namespace, valueFilenames, opts)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return fmt.Errorf("could not create %s: %s", outDir, err)
+	}
+
+	written := map[string]bool{}
+	for _, doc := range splitDocuments(b) {
+		objs, err := decodeObjects(doc)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			content, err := yaml.Marshal(obj.Object)
+			if err != nil {
+				return err
+			}
+			name := strings.ToLower(obj.GetKind() + "-" + obj.GetName())
+			if obj.GetName() == "" {
+				name = strings.ToLower(obj.GetKind() + "-" + obj.GetGenerateName())
+			}
+			filename := name + ".yaml"
+			// the same kind and name may be in different namespaces
+			for i := 2; written[filename]; i++ {
+				filename = fmt.Sprintf("%s-%d.yaml", name, i)
+			}
+			written[filename] = true
+			if err := ioutil.WriteFile(filepath.Join(outDir, filename), content, 0o644); err != nil {
+				return fmt.Errorf("could not write %s: %s", filename, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package kedge
+
+import (
+	"encoding/json"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// replaceListsAnnotation lists, comma separated, the list fields of an object
+// that strategic merge patches replace instead of merging, eg
+// "spec.template.spec.containers". See Options.ReplaceLists.
+const replaceListsAnnotation = "kedge.io/replace-lists"
+
+// replacedLists returns the paths of the lists of obj to replace, from
+// Options.ReplaceLists and the annotation of obj.
+func (a *applier) replacedLists(obj *unstructured.Unstructured) []string {
+	paths := append([]string{}, a.opts.ReplaceLists[obj.GetKind()]...)
+	for _, path := range strings.Split(obj.GetAnnotations()[replaceListsAnnotation], ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// withReplacedLists sets the lists at paths of a strategic merge patch to
+// their value in obj along with the `$patch: replace` directive, so the
+// server replaces them as a whole. Lists obj doesn't have are left alone.
+func withReplacedLists(patch []byte, obj *unstructured.Unstructured, paths []string) ([]byte, error) {
+	if len(paths) == 0 {
+		return patch, nil
+	}
+	p := map[string]interface{}{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		fields := strings.Split(path, ".")
+		list, ok, _ := unstructured.NestedSlice(obj.Object, fields...)
+		if !ok {
+			continue
+		}
+		if isObjectList(list) {
+			list = append(list, map[string]interface{}{"$patch": "replace"})
+		}
+		if err := unstructured.SetNestedSlice(p, list, fields...); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(p)
+}
+
+// isObjectList reports whether list holds objects, the only lists the
+// `$patch: replace` directive can be added to. Other lists are replaced by
+// the value in the patch already.
+func isObjectList(list []interface{}) bool {
+	for _, item := range list {
+		if _, ok := item.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return true
+}
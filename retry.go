@@ -0,0 +1,64 @@
+package kedge
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// retriesAnnotation overrides Options.Retries for a single object, eg
+// `kedge.io/retries: "5"` for an object guarded by a flaky webhook.
+const retriesAnnotation = "kedge.io/retries"
+
+// retryDelay is how long kedge waits before the first retry of an object.
+// The delay doubles with every retry.
+var retryDelay = time.Second
+
+// retry calls apply until it succeeds, fails with an error that retrying
+// won't fix, or the retries of obj are exhausted.
+func (a *applier) retry(obj *unstructured.Unstructured, apply func() error) error {
+	retries, err := a.retries(obj)
+	if err != nil {
+		return err
+	}
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		err = apply()
+		if err == nil || attempt >= retries || !isRetryable(err) {
+			return err
+		}
+		a.logf("[WARN] %s '%s/%s' failed, retrying in %s: %s", obj.GetKind(), obj.GetNamespace(), obj.GetName(), delay, err)
+		select {
+		case <-a.context().Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// retries returns how many times obj is retried.
+func (a *applier) retries(obj *unstructured.Unstructured) (int, error) {
+	value, ok := obj.GetAnnotations()[retriesAnnotation]
+	if !ok {
+		return a.opts.Retries, nil
+	}
+	retries, err := strconv.Atoi(value)
+	if err != nil || retries < 0 {
+		return 0, fmt.Errorf("ERROR: %s '%s/%s': invalid %s annotation '%s', expected a number of retries", obj.GetKind(), obj.GetNamespace(), obj.GetName(), retriesAnnotation, value)
+	}
+	return retries, nil
+}
+
+// isRetryable reports whether err may go away by itself, eg a webhook or
+// the API server being briefly unavailable.
+func isRetryable(err error) bool {
+	return kerrors.IsInternalError(err) ||
+		kerrors.IsServerTimeout(err) ||
+		kerrors.IsTimeout(err) ||
+		kerrors.IsTooManyRequests(err) ||
+		kerrors.IsServiceUnavailable(err)
+}
@@ -0,0 +1,161 @@
+package kedge
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// defaultWaitTimeout is how long Options.Wait waits for each object when
+// Options.WaitTimeout is not set.
+const defaultWaitTimeout = 5 * time.Minute
+
+// objectKey identifies an object within a single apply.
+func objectKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// clientForResult returns a client for the object a result is about.
+func (a *applier) clientForResult(result Result) (dynamic.ResourceInterface, error) {
+	gvk := schema.FromAPIVersionAndKind(result.APIVersion, result.Kind)
+	namespaceableResourceClient, isNamespaced, err := a.namespaceableClient(gvk)
+	if err != nil {
+		return nil, err
+	}
+	if isNamespaced {
+		return namespaceableResourceClient.Namespace(result.Namespace), nil
+	}
+	return namespaceableResourceClient, nil
+}
+
+// recordPrior saves the live state of obj, or that it didn't exist, so it
+// can be restored by Options.RollbackOnFailure.
+func (a *applier) recordPrior(ctx context.Context, client dynamic.ResourceInterface, obj *unstructured.Unstructured) error {
+	if a.priors == nil {
+		a.priors = map[string]*unstructured.Unstructured{}
+	}
+	key := objectKey(obj.GetKind(), obj.GetNamespace(), obj.GetName())
+	live, err := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			a.priors[key] = nil
+			return nil
+		}
+		return err
+	}
+	a.priors[key] = live
+	return nil
+}
+
+// waitForResults waits for the workloads among results to become ready. When
+// one doesn't and Options.RollbackOnFailure is set, it is restored to the
+// state recorded before it was applied.
+func (a *applier) waitForResults(results []Result) error {
+	ctx := a.context()
+	for _, result := range results {
+		if !isWorkload(result.Kind) || result.Action == ActionUnchanged {
+			continue
+		}
+		client, err := a.clientForResult(result)
+		if err != nil {
+			return err
+		}
+		a.logf("Waiting for %s '%s/%s' to be ready", result.Kind, result.Namespace, result.Name)
+		err = poll(ctx, a.opts.waitTimeout(), func(ctx context.Context) (bool, error) {
+			live, err := client.Get(ctx, result.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return workloadReady(live), nil
+		})
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("%s '%s/%s' did not become ready: %s", result.Kind, result.Namespace, result.Name, err)
+		if !a.opts.RollbackOnFailure {
+			return err
+		}
+		if rollbackErr := a.rollback(ctx, client, result); rollbackErr != nil {
+			return fmt.Errorf("%s, and could not be rolled back: %s", err, rollbackErr)
+		}
+		return fmt.Errorf("%s, it has been rolled back", err)
+	}
+	return nil
+}
+
+// rollback restores an object to the state recorded by recordPrior. An object
+// that didn't exist before is deleted.
+func (a *applier) rollback(ctx context.Context, client dynamic.ResourceInterface, result Result) error {
+	prior, ok := a.priors[objectKey(result.Kind, result.Namespace, result.Name)]
+	if !ok {
+		return fmt.Errorf("no prior state was recorded")
+	}
+	if prior == nil {
+		propagationPolicy := metav1.DeletePropagationBackground
+		err := client.Delete(ctx, result.Name, metav1.DeleteOptions{PropagationPolicy: &propagationPolicy})
+		if err == nil {
+			a.logf("%s '%s/%s' has been deleted", result.Kind, result.Namespace, result.Name)
+		}
+		return err
+	}
+	current, err := client.Get(ctx, result.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	prior = prior.DeepCopy()
+	prior.SetResourceVersion(current.GetResourceVersion())
+	unstructured.RemoveNestedField(prior.Object, "metadata", "managedFields")
+	_, err = client.Update(ctx, prior, metav1.UpdateOptions{})
+	if err == nil {
+		a.logf("%s '%s/%s' has been rolled back", result.Kind, result.Namespace, result.Name)
+	}
+	return err
+}
+
+func isWorkload(kind string) bool {
+	switch kind {
+	case "Deployment", "StatefulSet", "DaemonSet":
+		return true
+	}
+	return false
+}
+
+// workloadReady reports whether a Deployment, StatefulSet or DaemonSet has
+// rolled out its latest spec.
+func workloadReady(obj *unstructured.Unstructured) bool {
+	generation := obj.GetGeneration()
+	observed, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if observed < generation {
+		return false
+	}
+	status := func(field string) int64 {
+		v, _, _ := unstructured.NestedInt64(obj.Object, "status", field)
+		return v
+	}
+	switch obj.GetKind() {
+	case "Deployment":
+		replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+		if !found {
+			replicas = 1
+		}
+		return status("updatedReplicas") == replicas && status("availableReplicas") == replicas && status("replicas") == replicas
+	case "StatefulSet":
+		replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+		if !found {
+			replicas = 1
+		}
+		current, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+		update, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+		return status("readyReplicas") == replicas && status("updatedReplicas") == replicas && current == update
+	case "DaemonSet":
+		desired := status("desiredNumberScheduled")
+		return status("updatedNumberScheduled") == desired && status("numberAvailable") == desired
+	}
+	return true
+}
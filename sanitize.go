@@ -0,0 +1,46 @@
+package kedge
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// sanitizeForApply removes the metadata of obj that identifies a stored
+// object rather than describes one, so manifests exported from a cluster can
+// be applied again:
+//
+//   - metadata.selfLink, metadata.resourceVersion and metadata.uid, always.
+//     The server rejects updates with a stale resourceVersion.
+//   - metadata.ownerReferences, unless opts.KeepOwnerReferences is set,
+//     since the owners' UIDs don't match in another cluster.
+//   - metadata.creationTimestamp, metadata.managedFields,
+//     metadata.generation and status, unless opts.KeepServerFields is set.
+//   - the annotations kedge computes for each apply, the hash of
+//     SkipUnchanged and the last applied configuration of ThreeWayMerge,
+//     always. Annotations that configure kedge, like the wait-for one, are
+//     kept.
+//
+// Options.Owner is set afterwards, it isn't affected by
+// KeepOwnerReferences.
+func sanitizeForApply(obj *unstructured.Unstructured, opts Options) {
+	// selfLink isn't set by servers since 1.20 but may be in old exports
+	unstructured.RemoveNestedField(obj.Object, "metadata", "selfLink")
+	unstructured.RemoveNestedField(obj.Object, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(obj.Object, "metadata", "uid")
+	if !opts.KeepOwnerReferences {
+		unstructured.RemoveNestedField(obj.Object, "metadata", "ownerReferences")
+	}
+	if !opts.KeepServerFields {
+		removeServerFields(obj)
+	}
+	annotations := obj.GetAnnotations()
+	_, hashed := annotations[hashAnnotation]
+	_, lastApplied := annotations[lastAppliedAnnotation]
+	if hashed || lastApplied {
+		delete(annotations, hashAnnotation)
+		delete(annotations, lastAppliedAnnotation)
+		if len(annotations) == 0 {
+			annotations = nil
+		}
+		obj.SetAnnotations(annotations)
+	}
+}
@@ -0,0 +1,125 @@
+package kedge
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// exported is a ConfigMap as read back from a cluster.
+func exported() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":              "settings",
+			"namespace":         "team",
+			"selfLink":          "/api/v1/namespaces/team/configmaps/settings",
+			"resourceVersion":   "42",
+			"uid":               "0f7c6a5e-1d2b-4c3a-9e8f-7a6b5c4d3e2f",
+			"creationTimestamp": "2023-01-02T03:04:05Z",
+			"generation":        int64(3),
+			"managedFields":     []interface{}{map[string]interface{}{"manager": "kedge"}},
+			"ownerReferences":   []interface{}{map[string]interface{}{"kind": "Deployment", "name": "app"}},
+			"annotations": map[string]interface{}{
+				hashAnnotation:        "abc",
+				lastAppliedAnnotation: `{"kind":"ConfigMap"}`,
+				waitForAnnotation:     "ready",
+			},
+		},
+		"data":   map[string]interface{}{"level": "debug"},
+		"status": map[string]interface{}{"phase": "Active"},
+	}}
+}
+
+func TestSanitizeForApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		removed [][]string
+		kept    [][]string
+	}{
+		{
+			name: "defaults",
+			removed: [][]string{
+				{"metadata", "selfLink"},
+				{"metadata", "resourceVersion"},
+				{"metadata", "uid"},
+				{"metadata", "ownerReferences"},
+				{"metadata", "creationTimestamp"},
+				{"metadata", "managedFields"},
+				{"metadata", "generation"},
+				{"status"},
+				{"metadata", "annotations", hashAnnotation},
+				{"metadata", "annotations", lastAppliedAnnotation},
+			},
+			kept: [][]string{
+				{"metadata", "name"},
+				{"metadata", "namespace"},
+				{"metadata", "annotations", waitForAnnotation},
+				{"data"},
+			},
+		},
+		{
+			name: "KeepServerFields",
+			opts: Options{KeepServerFields: true},
+			removed: [][]string{
+				{"metadata", "resourceVersion"},
+				{"metadata", "uid"},
+				{"metadata", "ownerReferences"},
+			},
+			kept: [][]string{
+				{"metadata", "creationTimestamp"},
+				{"metadata", "managedFields"},
+				{"metadata", "generation"},
+				{"status"},
+			},
+		},
+		{
+			name:    "KeepOwnerReferences",
+			opts:    Options{KeepOwnerReferences: true},
+			removed: [][]string{{"metadata", "uid"}, {"status"}},
+			kept:    [][]string{{"metadata", "ownerReferences"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := exported()
+			sanitizeForApply(obj, tt.opts)
+			for _, path := range tt.removed {
+				if _, found, _ := unstructured.NestedFieldNoCopy(obj.Object, path...); found {
+					t.Errorf("%v was kept", path)
+				}
+			}
+			for _, path := range tt.kept {
+				if _, found, _ := unstructured.NestedFieldNoCopy(obj.Object, path...); !found {
+					t.Errorf("%v was removed", path)
+				}
+			}
+		})
+	}
+}
+
+func TestSanitizeForApplyDropsEmptyAnnotations(t *testing.T) {
+	obj := exported()
+	obj.SetAnnotations(map[string]string{hashAnnotation: "abc"})
+	sanitizeForApply(obj, Options{})
+	if _, found, _ := unstructured.NestedFieldNoCopy(obj.Object, "metadata", "annotations"); found {
+		t.Errorf("got annotations %v, want none", obj.GetAnnotations())
+	}
+}
+
+func TestSanitizeForApplyLeavesManifestsAlone(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "settings", "labels": map[string]interface{}{"app": "web"}},
+		"data":       map[string]interface{}{"level": "debug"},
+	}}
+	want := obj.DeepCopy()
+	sanitizeForApply(obj, Options{})
+	if !reflect.DeepEqual(obj.Object, want.Object) {
+		t.Errorf("got %v, want %v", obj.Object, want.Object)
+	}
+}
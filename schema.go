@@ -0,0 +1,74 @@
+package kedge
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ghodss/yaml"
+)
+
+// readValuesSchema reads a JSON schema, in JSON or YAML.
+func readValuesSchema(filename string) (map[string]interface{}, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	schema := map[string]interface{}{}
+	if err := yaml.Unmarshal(b, &schema); err != nil {
+		return nil, fmt.Errorf("could not parse values schema %s: %s", filename, err)
+	}
+	return schema, nil
+}
+
+// applySchemaDefaults sets the default of every property of schema missing
+// from values. Objects missing from values are created when one of their
+// properties has a default. Only "properties", "items" and "default" are
+// looked at, "$ref" and combinators like "allOf" are not followed.
+func applySchemaDefaults(values map[string]interface{}, schema map[string]interface{}) {
+	properties, _ := schema["properties"].(map[string]interface{})
+	for key, p := range properties {
+		property, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok := values[key]; !ok {
+			if def, ok := property["default"]; ok {
+				values[key] = deepCopyValue(def)
+			} else if hasDefaults(property) {
+				values[key] = map[string]interface{}{}
+			}
+		}
+		applyValueDefaults(values[key], property)
+	}
+}
+
+func applyValueDefaults(value interface{}, schema map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		applySchemaDefaults(v, schema)
+	case []interface{}:
+		items, ok := schema["items"].(map[string]interface{})
+		if !ok {
+			return
+		}
+		for _, item := range v {
+			applyValueDefaults(item, items)
+		}
+	}
+}
+
+// hasDefaults reports whether any property below an object schema has a
+// default.
+func hasDefaults(schema map[string]interface{}) bool {
+	properties, _ := schema["properties"].(map[string]interface{})
+	for _, p := range properties {
+		property, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok := property["default"]; ok || hasDefaults(property) {
+			return true
+		}
+	}
+	return false
+}
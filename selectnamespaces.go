@@ -0,0 +1,69 @@
+package kedge
+
+import (
+	"fmt"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/rest"
+)
+
+var namespaceResource = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+
+// NamespaceResult is the outcome of applying to one namespace.
+type NamespaceResult struct {
+	Namespace string
+	Results   []Result
+	Err       error
+}
+
+// SelectNamespaces returns the names of the namespaces matching the label
+// selector, eg "team=payments", sorted.
+func SelectNamespaces(config *rest.Config, selector string, opts Options) ([]string, error) {
+	a := newApplier(config, opts)
+	client, err := a.cluster.Dynamic()
+	if err != nil {
+		return nil, err
+	}
+	list, err := client.Resource(namespaceResource).List(a.context(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: could not list namespaces matching '%s': %w", selector, err)
+	}
+	names := make([]string, 0, len(list.Items))
+	for _, item := range list.Items {
+		names = append(names, item.GetName())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ApplyToNamespaces renders and applies the template to every namespace
+// matching the label selector, see ApplyWithOptions, eg policies every team
+// namespace must have. The namespaces are listed on each call so new ones
+// are picked up. Objects of the manifest with a namespace of their own, and
+// cluster scoped ones, are applied once per matching namespace as well.
+//
+// Every namespace is applied to even if another one fails; the errors of
+// all failed namespaces are returned together. The results are sorted by
+// namespace.
+func ApplyToNamespaces(config *rest.Config, inputFilename, selector string, valueFilenames []string, opts Options) ([]NamespaceResult, error) {
+	namespaces, err := SelectNamespaces(config, selector, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(namespaces) == 0 {
+		opts.logger().Printf("[WARN] no namespace matches '%s'", selector)
+	}
+	namespaceResults := make([]NamespaceResult, 0, len(namespaces))
+	errs := []error{}
+	for _, namespace := range namespaces {
+		results, err := ApplyWithOptions(config, inputFilename, namespace, valueFilenames, opts)
+		namespaceResults = append(namespaceResults, NamespaceResult{Namespace: namespace, Results: results, Err: err})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("namespace '%s': %s", namespace, err))
+		}
+	}
+	return namespaceResults, utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,62 @@
+package kedge
+
+import "fmt"
+
+// sharedValues are the values documents share with the "share" template
+// function and read with "shared". See Options.TwoPassRender.
+type sharedValues struct {
+	values map[string]interface{}
+	// set are the keys shared during the current pass
+	set map[string]bool
+	// final is set for the pass whose output is used, reading a value that
+	// isn't shared is only an error then
+	final bool
+}
+
+func newSharedValues() *sharedValues {
+	return &sharedValues{values: map[string]interface{}{}, set: map[string]bool{}}
+}
+
+// share stores value under key and returns it. A value shared in the first
+// pass is kept in the second one, so generated values, like random
+// passwords, are the same in every document.
+func (s *sharedValues) share(key string, value interface{}) (interface{}, error) {
+	if s.set[key] {
+		return nil, fmt.Errorf("a value is already shared as %q", key)
+	}
+	s.set[key] = true
+	if previous, ok := s.values[key]; ok {
+		return previous, nil
+	}
+	s.values[key] = value
+	return value, nil
+}
+
+// get returns the value shared as key.
+func (s *sharedValues) get(key string) (interface{}, error) {
+	value, ok := s.values[key]
+	if ok {
+		return value, nil
+	}
+	if s.final {
+		return nil, fmt.Errorf("no value is shared as %q", key)
+	}
+	// an empty string keeps functions expecting a string working in the
+	// first pass
+	return "", nil
+}
+
+// renderPasses calls render with the shared values set in opts, twice with
+// opts.TwoPassRender so a document can read values shared by the documents
+// after it. Only the output of the last pass is returned.
+func renderPasses(opts Options, render func(Options) ([]byte, error)) ([]byte, error) {
+	opts.shared = newSharedValues()
+	if opts.TwoPassRender {
+		if _, err := render(opts); err != nil {
+			return nil, err
+		}
+		opts.shared.set = map[string]bool{}
+	}
+	opts.shared.final = true
+	return render(opts)
+}
@@ -0,0 +1,77 @@
+package kedge
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// state is what Options.StateFile stores between applies.
+type state struct {
+	// Host is the API server the objects were applied to, the state of
+	// another cluster is ignored.
+	Host string `json:"host"`
+	// Objects are the hashes of the objects applied, by objectKey.
+	Objects map[string]string `json:"objects"`
+	// pending are the hashes of the objects being applied, moved to Objects
+	// once they have been.
+	pending map[string]string
+}
+
+// loadState reads Options.StateFile. A missing file, or the file of another
+// cluster, gives an empty state.
+func (a *applier) loadState() error {
+	a.state = &state{Host: a.config.Host, Objects: map[string]string{}, pending: map[string]string{}}
+	b, err := ioutil.ReadFile(a.opts.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read state file: %s", err)
+	}
+	s := state{}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("could not parse state file %s: %s", a.opts.StateFile, err)
+	}
+	if s.Host == a.config.Host && s.Objects != nil {
+		a.state.Objects = s.Objects
+	}
+	return nil
+}
+
+func (a *applier) saveState() error {
+	b, err := json.MarshalIndent(a.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writePrivateFile(a.opts.StateFile, b); err != nil {
+		return fmt.Errorf("could not write state file: %s", err)
+	}
+	return nil
+}
+
+// stateUnchanged reports whether obj was applied as is by a previous apply
+// according to the state file. It returns the hash to store once obj has
+// been applied.
+func (a *applier) stateUnchanged(obj *unstructured.Unstructured) (bool, string, error) {
+	hash, err := objectHash(obj)
+	if err != nil {
+		return false, "", err
+	}
+	return a.state.Objects[objectKey(obj.GetKind(), obj.GetNamespace(), obj.GetName())] == hash, hash, nil
+}
+
+// applied stores the hash of the object of result, once it has been applied.
+func (s *state) applied(result Result) {
+	if s == nil {
+		return
+	}
+	key := objectKey(result.Kind, result.Namespace, result.Name)
+	if hash, ok := s.pending[key]; ok {
+		s.Objects[key] = hash
+		delete(s.pending, key)
+	}
+}
@@ -0,0 +1,32 @@
+package kedge
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStateFileMode(t *testing.T) {
+	cluster, _ := newTestCluster()
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	opts := Options{Cluster: cluster, StateFile: stateFile}
+	if _, err := ApplyWithOptions(nil, writeManifest(t, settingsManifest), "team", nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("got mode %o, want 600", mode)
+	}
+
+	// the ConfigMap is skipped since it didn't change
+	results, err := ApplyWithOptions(nil, writeManifest(t, settingsManifest), "team", nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Action != ActionUnchanged {
+		t.Errorf("got %v, want the ConfigMap unchanged", results)
+	}
+}
@@ -0,0 +1,106 @@
+package kedge
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+)
+
+// ApplyStatus renders the manifest like ApplyWithOptions and sets the status
+// of every object to the status of the manifest through the status
+// subresource, eg for tools reporting the state of custom resources. The
+// objects must already exist and everything but their status is left as is.
+// Objects without a status in the manifest are skipped.
+func ApplyStatus(config *rest.Config, inputFilename, namespace string, valueFilenames []string, opts Options) ([]Result, error) {
+	opts.liveConfig = config
+	b, namespace, err := renderManifest(inputFilename, namespace, valueFilenames, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	a := newApplier(config, opts)
+	for _, doc := range splitDocuments(b) {
+		objs, err := decodeObjects(doc)
+		if err != nil {
+			return a.results, err
+		}
+		for _, obj := range objs {
+			if err := a.applyStatus(obj, namespace); err != nil {
+				return a.results, a.explainError(err)
+			}
+		}
+	}
+	return a.results, nil
+}
+
+func (a *applier) applyStatus(obj *unstructured.Unstructured, namespace string) error {
+	ctx := a.context()
+	status, found, err := unstructured.NestedFieldCopy(obj.Object, "status")
+	if err != nil || !found {
+		return nil
+	}
+	if err := a.checkGroup(obj.GroupVersionKind(), obj.GetName()); err != nil {
+		return err
+	}
+	client, namespace, err := a.resourceClient(obj, namespace)
+	if err != nil {
+		return err
+	}
+	gvk := obj.GroupVersionKind()
+	ok, err := a.hasStatusSubresource(gvk)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("ERROR: %s does not have a status subresource", gvk.Kind)
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		live, err := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(live.Object, status, "status"); err != nil {
+			return err
+		}
+		_, err = client.UpdateStatus(ctx, live, metav1.UpdateOptions{FieldValidation: a.opts.fieldValidation()})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("ERROR: could not update status of %s '%s/%s': %w", gvk.Kind, namespace, obj.GetName(), err)
+	}
+	a.logf("%s '%s/%s' status has been updated", gvk.Kind, namespace, obj.GetName())
+	return a.record(Result{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       gvk.Kind,
+		Namespace:  namespace,
+		Name:       obj.GetName(),
+		Action:     ActionUpdated,
+	})
+}
+
+// hasStatusSubresource reports whether the resource of gvk serves the status
+// subresource.
+func (a *applier) hasStatusSubresource(gvk schema.GroupVersionKind) (bool, error) {
+	resources, err := a.cluster.Resources(gvk.GroupVersion().String())
+	if err != nil {
+		return false, err
+	}
+	resource := ""
+	for _, r := range resources {
+		if r.Kind == gvk.Kind && !strings.Contains(r.Name, "/") {
+			resource = r.Name
+		}
+	}
+	for _, r := range resources {
+		if resource != "" && r.Name == resource+"/status" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,20 @@
+package kedge
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestApplyStatusAllowedGroups(t *testing.T) {
+	cluster, client := newTestCluster()
+	cluster.APIResources = append(cluster.APIResources, metav1.APIResource{Group: "apps", Version: "v1", Kind: "Deployment", Name: "deployments/status", Namespaced: true, Verbs: metav1.Verbs{"get", "update"}})
+	manifest := writeManifest(t, "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\nstatus:\n  replicas: 1\n")
+	opts := Options{Cluster: cluster, AllowedGroups: []string{""}}
+	if _, err := ApplyStatus(nil, manifest, "team", nil, opts); err == nil {
+		t.Fatal("got no error, want the Deployment rejected")
+	}
+	if len(client.Actions()) > 0 {
+		t.Errorf("got %d requests, want the Deployment rejected before the cluster is called", len(client.Actions()))
+	}
+}
@@ -0,0 +1,66 @@
+package kedge
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// duplicateKeys returns an error naming the key and lines when a mapping of
+// the YAML document content defines a key twice. ghodss/yaml keeps the last
+// value silently, see Options.StrictYAML.
+func duplicateKeys(content []byte) error {
+	var v interface{}
+	err := yamlv3.Unmarshal(content, &v)
+	if err == nil {
+		return nil
+	}
+	if typeErr, ok := err.(*yamlv3.TypeError); ok {
+		for _, msg := range typeErr.Errors {
+			if strings.Contains(msg, "already defined") {
+				return fmt.Errorf("%s", msg)
+			}
+		}
+	}
+	// everything else is left to the usual decoding to report
+	return nil
+}
+
+// checkStrictValues checks the YAML value files for duplicate keys.
+func checkStrictValues(filenames []string) error {
+	for _, filename := range filenames {
+		if !isYAMLValues(filename) {
+			continue
+		}
+		content, err := readValueFile(filename)
+		if err != nil {
+			return fmt.Errorf("unable to read values file: %s", err)
+		}
+		// stdin may be a stream of documents
+		for _, doc := range splitDocuments(content) {
+			if err := duplicateKeys(doc); err != nil {
+				return fmt.Errorf("values file %s: %s", filename, err)
+			}
+		}
+	}
+	return nil
+}
+
+// isYAMLValues reports whether decodeValues parses filename as YAML.
+func isYAMLValues(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext != ".env" && ext != ".toml" && strings.ToLower(filepath.Base(filename)) != ".env"
+}
+
+// checkStrictManifest checks the documents of a rendered manifest for
+// duplicate keys, they are counted from 1.
+func checkStrictManifest(docs [][]byte) error {
+	for i, doc := range docs {
+		if err := duplicateKeys(doc); err != nil {
+			return fmt.Errorf("document %d of the manifest: %s", i+1, err)
+		}
+	}
+	return nil
+}
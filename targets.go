@@ -0,0 +1,98 @@
+package kedge
+
+import (
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// clusterScopedKinds are the builtin kinds which are not namespaced, keyed by
+// group and kind.
+var clusterScopedKinds = map[string]bool{
+	"Namespace":                             true,
+	"Node":                                  true,
+	"PersistentVolume":                      true,
+	"ComponentStatus":                       true,
+	"ClusterRole.rbac.authorization.k8s.io": true,
+	"ClusterRoleBinding.rbac.authorization.k8s.io":                  true,
+	"CustomResourceDefinition.apiextensions.k8s.io":                 true,
+	"APIService.apiregistration.k8s.io":                             true,
+	"StorageClass.storage.k8s.io":                                   true,
+	"CSIDriver.storage.k8s.io":                                      true,
+	"CSINode.storage.k8s.io":                                        true,
+	"VolumeAttachment.storage.k8s.io":                               true,
+	"PriorityClass.scheduling.k8s.io":                               true,
+	"RuntimeClass.node.k8s.io":                                      true,
+	"IngressClass.networking.k8s.io":                                true,
+	"CertificateSigningRequest.certificates.k8s.io":                 true,
+	"MutatingWebhookConfiguration.admissionregistration.k8s.io":     true,
+	"ValidatingWebhookConfiguration.admissionregistration.k8s.io":   true,
+	"ValidatingAdmissionPolicy.admissionregistration.k8s.io":        true,
+	"ValidatingAdmissionPolicyBinding.admissionregistration.k8s.io": true,
+	"FlowSchema.flowcontrol.apiserver.k8s.io":                       true,
+	"PriorityLevelConfiguration.flowcontrol.apiserver.k8s.io":       true,
+	"PodSecurityPolicy.policy":                                      true,
+}
+
+// TargetNamespaces renders the template and returns the namespaces its
+// objects would be applied to, sorted, when applied with defaultNamespace.
+//
+// No cluster is involved so kinds are assumed to be namespaced unless they
+// are builtin cluster scoped kinds, like ClusterRole. Custom resources which
+// are cluster scoped are counted in defaultNamespace.
+func TargetNamespaces(inputFilename, defaultNamespace string, valueFilenames []string) ([]string, error) {
+	return TargetNamespacesWithOptions(inputFilename, defaultNamespace, valueFilenames, Options{})
+}
+
+// TargetNamespacesWithOptions is TargetNamespaces using opts, which may
+// change the namespaces with ForceNamespace or the values.
+func TargetNamespacesWithOptions(inputFilename, defaultNamespace string, valueFilenames []string, opts Options) ([]string, error) {
+	b, namespace, err := renderManifest(inputFilename, defaultNamespace, valueFilenames, opts)
+	if err != nil {
+		return nil, err
+	}
+	namespaces, err := targetNamespaces(splitDocuments(b), namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(namespaces) > 1 {
+		opts.logger().Printf("[WARN] %s spans %d namespaces: %s", inputFilename, len(namespaces), strings.Join(namespaces, ", "))
+	}
+	return namespaces, nil
+}
+
+// targetNamespace returns the namespace obj is applied to without asking the
+// cluster, empty for builtin cluster scoped kinds.
+func targetNamespace(obj *unstructured.Unstructured, namespace string, opts Options) string {
+	if clusterScopedKinds[obj.GroupVersionKind().GroupKind().String()] {
+		return ""
+	}
+	if obj.GetNamespace() == "" || (opts.ForceNamespace && namespace != "") {
+		return namespace
+	}
+	return obj.GetNamespace()
+}
+
+// targetNamespaces returns the namespaces of the namespaced objects of docs,
+// sorted, see resourceClient for how namespace applies.
+func targetNamespaces(docs [][]byte, namespace string, opts Options) ([]string, error) {
+	seen := map[string]bool{}
+	for _, doc := range docs {
+		objs, err := decodeObjects(doc)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			if ns := targetNamespace(obj, namespace, opts); ns != "" {
+				seen[ns] = true
+			}
+		}
+	}
+	namespaces := make([]string, 0, len(seen))
+	for ns := range seen {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
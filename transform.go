@@ -0,0 +1,54 @@
+package kedge
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// TransformFunc changes an object right before it is sent to the cluster.
+type TransformFunc func(obj *unstructured.Unstructured) error
+
+// Transformers is a registry of TransformFuncs keyed by the kind of object
+// they apply to, eg
+//
+//	t := NewTransformers().RegisterKind("Deployment", setPullPolicy)
+type Transformers struct {
+	byGVK  map[schema.GroupVersionKind][]TransformFunc
+	byKind map[string][]TransformFunc
+}
+
+// NewTransformers returns an empty registry.
+func NewTransformers() *Transformers {
+	return &Transformers{
+		byGVK:  map[schema.GroupVersionKind][]TransformFunc{},
+		byKind: map[string][]TransformFunc{},
+	}
+}
+
+// Register adds fn for objects of exactly gvk.
+func (t *Transformers) Register(gvk schema.GroupVersionKind, fn TransformFunc) *Transformers {
+	t.byGVK[gvk] = append(t.byGVK[gvk], fn)
+	return t
+}
+
+// RegisterKind adds fn for objects of kind, in any group or version.
+func (t *Transformers) RegisterKind(kind string, fn TransformFunc) *Transformers {
+	t.byKind[kind] = append(t.byKind[kind], fn)
+	return t
+}
+
+// transform runs the functions registered for the kind of obj, followed by
+// the ones registered for its exact GroupVersionKind, in registration order.
+func (t *Transformers) transform(obj *unstructured.Unstructured) error {
+	if t == nil {
+		return nil
+	}
+	gvk := obj.GroupVersionKind()
+	fns := append(append([]TransformFunc{}, t.byKind[gvk.Kind]...), t.byGVK[gvk]...)
+	for _, fn := range fns {
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
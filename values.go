@@ -0,0 +1,345 @@
+package kedge
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ghodss/yaml"
+)
+
+// stdinValues is the value file name reading the values from stdin.
+const stdinValues = "-"
+
+var (
+	stdinOnce    sync.Once
+	stdinContent []byte
+	stdinErr     error
+)
+
+// readValueFile returns the content of a value file, or of stdin for
+// stdinValues. Stdin is only read once, later reads get the same content.
+func readValueFile(filename string) ([]byte, error) {
+	if filename != stdinValues {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, valueFileError(filename, err)
+		}
+		return content, nil
+	}
+	stdinOnce.Do(func() {
+		stdinContent, stdinErr = ioutil.ReadAll(os.Stdin)
+	})
+	return stdinContent, stdinErr
+}
+
+// valueFileError explains why the value file couldn't be read, from the
+// error of reading it: a directory, a glob the shell left as is because no
+// file matches it, or else the error itself, which names the file.
+func valueFileError(filename string, err error) error {
+	if info, statErr := os.Stat(filename); statErr == nil && info.IsDir() {
+		return fmt.Errorf("expected a file, got a directory: %s", filename)
+	}
+	if os.IsNotExist(err) && strings.ContainsAny(filename, "*?[") {
+		if matches, globErr := filepath.Glob(filename); globErr == nil && len(matches) == 0 {
+			return fmt.Errorf("the pattern %s matches no file", filename)
+		}
+	}
+	return err
+}
+
+// ValueSource provides the values of a single value layer.
+type ValueSource interface {
+	Values() (map[string]interface{}, error)
+}
+
+// ValueFiles is a ValueSource reading YAML value files, merged in order.
+type ValueFiles []string
+
+// Values implements ValueSource.
+func (f ValueFiles) Values() (map[string]interface{}, error) {
+	return combineValues(f, false)
+}
+
+// InlineValues is a ValueSource for values built in code.
+type InlineValues map[string]interface{}
+
+// Values implements ValueSource. The map is copied so merging never changes
+// the caller's data.
+func (v InlineValues) Values() (map[string]interface{}, error) {
+	return deepCopyMap(v), nil
+}
+
+// ValueLayers merges named layers of values in the order they were added.
+// Later layers take precedence, eg
+//
+//	layers := NewValueLayers().
+//		WithValueLayer("defaults", ValueFiles{"values.yaml"}).
+//		WithValueLayer("environment", ValueFiles{"prod.yaml"}).
+//		WithValueLayer("overrides", InlineValues{"replicas": 5})
+type ValueLayers struct {
+	layers []valueLayer
+}
+
+type valueLayer struct {
+	name   string
+	source ValueSource
+}
+
+// NewValueLayers returns an empty set of value layers.
+func NewValueLayers() *ValueLayers {
+	return &ValueLayers{}
+}
+
+// WithValueLayer adds a layer that takes precedence over every layer added
+// before it.
+func (l *ValueLayers) WithValueLayer(name string, source ValueSource) *ValueLayers {
+	l.layers = append(l.layers, valueLayer{name: name, source: source})
+	return l
+}
+
+// Precedence returns the layer names from lowest to highest precedence.
+func (l *ValueLayers) Precedence() []string {
+	names := make([]string, 0, len(l.layers))
+	for _, layer := range l.layers {
+		names = append(names, layer.name)
+	}
+	return names
+}
+
+// Merge reads every layer and merges them in precedence order.
+func (l *ValueLayers) Merge() (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	if l == nil || len(l.layers) == 0 {
+		return data, nil
+	}
+	for _, layer := range l.layers {
+		d, err := layer.source.Values()
+		if err != nil {
+			return data, fmt.Errorf("value layer '%s': %s", layer.name, err)
+		}
+		data = mergeMaps(data, d, false)
+	}
+	return data, nil
+}
+
+// deepCopyMap copies the nested maps and slices of m. mergeMaps reuses the
+// maps it's given so sources that are merged more than once must be copied.
+func deepCopyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = deepCopyValue(v)
+	}
+	return c
+}
+
+func deepCopyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return deepCopyMap(v)
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, item := range v {
+			c[i] = deepCopyValue(item)
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// combineTemplatedValues merges value files like combineValues, rendering
+// each file as a template before it is parsed. A file is rendered with the
+// values merged from the files before it, so a file can only refer to values
+// of earlier files, never its own or later ones. Each file is rendered
+// exactly once and the output is not rendered again, so values containing
+// "{{" can't make rendering recurse.
+func combineTemplatedValues(filesToMerge []string, opts Options) (map[string]interface{}, error) {
+	types := newTypeWatcher(opts)
+	data := make(map[string]interface{})
+	for _, file := range filesToMerge {
+		content, err := readValueFile(file)
+		if err != nil {
+			return data, fmt.Errorf("unable to read values file: %s", err)
+		}
+		tpl, err := newTemplate(filepath.Base(file), newFiles(filepath.Dir(file)), templateFuncs(opts)).Parse(string(content))
+		if err != nil {
+			return data, fmt.Errorf("could not parse values file %s: %s", file, err)
+		}
+		buf := bytes.NewBuffer([]byte{})
+		if err := tpl.Execute(buf, deepCopyMap(data)); err != nil {
+			return data, fmt.Errorf("could not render values file %s: %s", file, err)
+		}
+		if opts.StrictYAML && isYAMLValues(file) {
+			if err := duplicateKeys(buf.Bytes()); err != nil {
+				return data, fmt.Errorf("values file %s: %s", file, err)
+			}
+		}
+		d, err := decodeValues(file, buf.Bytes())
+		if err != nil {
+			return data, fmt.Errorf("unable decode the values content of %s: %s", file, err)
+		}
+		types.check(data, d, file)
+		data = mergeMaps(data, d, false)
+	}
+	return data, nil
+}
+
+// setValues merges each `path=value` override into data, decoding the value
+// with unmarshal.
+func setValues(data map[string]interface{}, overrides []string, unmarshal func([]byte, interface{}) error) error {
+	for _, override := range overrides {
+		path, raw, ok := strings.Cut(override, "=")
+		if !ok || path == "" {
+			return fmt.Errorf("invalid value override '%s', expected path=value", override)
+		}
+		var value interface{}
+		if err := unmarshal([]byte(raw), &value); err != nil {
+			return fmt.Errorf("could not parse value override '%s': %s", override, err)
+		}
+		keys := strings.Split(path, ".")
+		for i := len(keys) - 1; i >= 0; i-- {
+			if keys[i] == "" {
+				return fmt.Errorf("invalid value override '%s', empty key in path", override)
+			}
+			value = map[string]interface{}{keys[i]: value}
+		}
+		mergeMaps(data, value.(map[string]interface{}), false)
+	}
+	return nil
+}
+
+// unmarshalString is the unmarshal of setValues for SetString, keeping the
+// value as is.
+func unmarshalString(b []byte, v interface{}) error {
+	*v.(*interface{}) = string(b)
+	return nil
+}
+
+// decodeValues parses the content of a value file by its extension: `.env`
+// files (including eg `prod.env`) give flat string values, `.toml` files
+// give nested values and anything else is YAML. The value file `-` is stdin,
+// a YAML stream whose documents are merged in order.
+func decodeValues(filename string, content []byte) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	switch ext := strings.ToLower(filepath.Ext(filename)); {
+	case filename == stdinValues:
+		// a stream of documents, merged in order
+		for _, doc := range splitDocuments(content) {
+			d := make(map[string]interface{})
+			if err := yaml.Unmarshal(doc, &d); err != nil {
+				return nil, err
+			}
+			data = mergeMaps(data, d, false)
+		}
+	case ext == ".env" || strings.ToLower(filepath.Base(filename)) == ".env":
+		return decodeDotenv(content)
+	case ext == ".toml":
+		if err := toml.Unmarshal(content, &data); err != nil {
+			return nil, err
+		}
+		// go through JSON so values have the same types as YAML values, eg
+		// float64 rather than int64 and []interface{} for arrays of tables
+		b, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		data = make(map[string]interface{})
+		if err := json.Unmarshal(b, &data); err != nil {
+			return nil, err
+		}
+	default:
+		if err := yaml.Unmarshal(content, &data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// decodeDotenv parses KEY=VALUE lines. Blank lines, comments and `export`
+// prefixes are ignored, quoted values are unquoted.
+func decodeDotenv(content []byte) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err)
+			}
+			value = unquoted
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		}
+		data[key] = value
+	}
+	return data, scanner.Err()
+}
+
+// applyProfile merges the profile called name, of the top level "profiles"
+// map of data, over the rest of data. The profiles are removed from data.
+func applyProfile(data map[string]interface{}, name string) (map[string]interface{}, error) {
+	profiles, _ := data["profiles"].(map[string]interface{})
+	profile, ok := profiles[name].(map[string]interface{})
+	if !ok {
+		defined := make([]string, 0, len(profiles))
+		for k := range profiles {
+			defined = append(defined, k)
+		}
+		sort.Strings(defined)
+		return nil, fmt.Errorf("profile '%s' is not defined in the values, the profiles are: %s", name, strings.Join(defined, ", "))
+	}
+	delete(data, "profiles")
+	return mergeMaps(data, profile, false), nil
+}
+
+// checkRequiredValues returns an error listing the dotted paths of required
+// that data has no value for. Like the "required" template function, empty
+// strings are missing values.
+func checkRequiredValues(data map[string]interface{}, required []string) error {
+	missing := []string{}
+	for _, path := range required {
+		var v interface{} = data
+		for _, key := range strings.Split(path, ".") {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				v = nil
+				break
+			}
+			v = m[key]
+		}
+		if s, ok := v.(string); v == nil || (ok && s == "") {
+			missing = append(missing, path)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required values: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package kedge
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"reflect"
+	"testing"
+)
+
+// recordingLogger is a Logger keeping what it is given.
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestValueLayersLogger(t *testing.T) {
+	var std bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&std)
+
+	logger := &recordingLogger{}
+	opts := Options{
+		Logger: logger,
+		ValueLayers: NewValueLayers().
+			WithValueLayer("defaults", InlineValues{"replicas": 1}).
+			WithValueLayer("overrides", InlineValues{"replicas": 5}),
+	}
+	b, _, err := renderManifest(writeManifest(t, "replicas: {{ .replicas }}\n"), "", nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "replicas: 5\n" {
+		t.Errorf("got %q, want replicas: 5", b)
+	}
+	want := []string{"Merging value layers: defaults < overrides"}
+	if !reflect.DeepEqual(logger.lines, want) {
+		t.Errorf("got %q logged, want %q", logger.lines, want)
+	}
+	if std.Len() > 0 {
+		t.Errorf("got %q logged by the log package, want nothing", std.String())
+	}
+}
+
+func TestSetValues(t *testing.T) {
+	opts := Options{
+		Set:       []string{"a=on", "b=no", "c=1e3", "d=0012", "e=1.20", "f=web", "nested.replicas=3"},
+		SetString: []string{"s.a=on", "s.b=no", "s.c=1e3", "s.d=0012", "s.e=1.20"},
+		SetJSON:   []string{`j={"a":"on","c":1e3}`},
+	}
+	data, err := mergeValues(nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		// Set parses YAML 1.1
+		"a":      true,
+		"b":      false,
+		"c":      float64(1000),
+		"d":      float64(10),
+		"e":      1.2,
+		"f":      "web",
+		"nested": map[string]interface{}{"replicas": float64(3)},
+		"s":      map[string]interface{}{"a": "on", "b": "no", "c": "1e3", "d": "0012", "e": "1.20"},
+		"j":      map[string]interface{}{"a": "on", "c": float64(1000)},
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("got %v, want %v", data, want)
+	}
+}
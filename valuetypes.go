@@ -0,0 +1,89 @@
+package kedge
+
+import (
+	"fmt"
+	"sort"
+)
+
+// typeWatcher warns when merging values changes the type of a key, eg an
+// override file quoting `replicas: "3"`. See Options.WarnTypeChanges.
+type typeWatcher struct {
+	logger Logger
+	// origins are the sources that last set each key path
+	origins map[string]string
+}
+
+// newTypeWatcher returns nil, which watches nothing, unless
+// opts.WarnTypeChanges is set.
+func newTypeWatcher(opts Options) *typeWatcher {
+	if !opts.WarnTypeChanges {
+		return nil
+	}
+	return &typeWatcher{logger: opts.logger(), origins: map[string]string{}}
+}
+
+// check warns about the keys of d which don't have the type they have in
+// data, before d from source is merged into data.
+func (w *typeWatcher) check(data, d map[string]interface{}, source string) {
+	if w == nil {
+		return
+	}
+	w.walk("", data, d, source)
+}
+
+func (w *typeWatcher) walk(path string, data, d map[string]interface{}, source string) {
+	keys := make([]string, 0, len(d))
+	for k := range d {
+		keys = append(keys, k)
+	}
+	// warn in a stable order
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := d[k]
+		p := joinPath(path, k)
+		old, exists := data[k]
+		if exists && old != nil && v != nil {
+			if oldType, newType := valueType(old), valueType(v); oldType != newType {
+				w.logger.Printf("[WARN] value %s changes from %s in %s to %s in %s", p, oldType, w.origins[p], newType, source)
+			}
+		}
+		m, isMap := v.(map[string]interface{})
+		n, wasMap := old.(map[string]interface{})
+		if isMap && wasMap {
+			w.walk(p, n, m, source)
+			continue
+		}
+		w.origins[p] = source
+		if isMap {
+			w.setOrigins(p, m, source)
+		}
+	}
+}
+
+// setOrigins records source for the nested keys of m replacing a value of
+// another type.
+func (w *typeWatcher) setOrigins(path string, m map[string]interface{}, source string) {
+	for k, v := range m {
+		p := joinPath(path, k)
+		w.origins[p] = source
+		if n, ok := v.(map[string]interface{}); ok {
+			w.setOrigins(p, n, source)
+		}
+	}
+}
+
+func valueType(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "a map"
+	case []interface{}:
+		return "a list"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case float64, int, int64:
+		return "a number"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,104 @@
+package kedge
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// rememberDesired keeps a copy of obj as it is sent to the server for
+// Options.VerifyAfterApply.
+func (a *applier) rememberDesired(obj *unstructured.Unstructured) {
+	if a.desired == nil {
+		a.desired = map[string]*unstructured.Unstructured{}
+	}
+	a.desired[objectKey(obj.GetKind(), obj.GetNamespace(), obj.GetName())] = asStored(obj)
+}
+
+// asStored returns a copy of obj in the form the server stores it, so it can
+// be compared to live objects.
+func asStored(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	stored := obj.DeepCopy()
+	if stored.GetKind() == "Secret" {
+		// stringData is write only, the server merges it into data
+		stringData, _, _ := unstructured.NestedStringMap(stored.Object, "stringData")
+		for k, v := range stringData {
+			unstructured.SetNestedField(stored.Object, base64.StdEncoding.EncodeToString([]byte(v)), "data", k)
+		}
+		unstructured.RemoveNestedField(stored.Object, "stringData")
+	}
+	return stored
+}
+
+// reportMutations warns about the fields of sent that the server stored with
+// another value, meaning something like a mutating webhook changes them
+// back on every apply, which then always has a patch to send.
+func (a *applier) reportMutations(sent, stored *unstructured.Unstructured) {
+	if !a.opts.DetectMutations || stored == nil {
+		return
+	}
+	paths := []string{}
+	for _, change := range fieldChanges("", asStored(sent).Object, stored.Object) {
+		if change.Old == nil && isEmptyValue(change.New) {
+			continue
+		}
+		paths = append(paths, change.Path)
+	}
+	if len(paths) == 0 {
+		return
+	}
+	a.warnings.add(fmt.Sprintf("%s '%s/%s' was stored with other values than applied for %s, likely by a mutating webhook; every apply will change them again",
+		sent.GetKind(), stored.GetNamespace(), stored.GetName(), strings.Join(paths, ", ")))
+}
+
+// verifyResults gets every applied object again and records the fields set
+// by the manifest that don't hold the applied value in Result.Drift.
+func (a *applier) verifyResults() error {
+	ctx := a.context()
+	for i, result := range a.results {
+		desired, ok := a.desired[objectKey(result.Kind, result.Namespace, result.Name)]
+		if !ok || result.Action == ActionDeleted {
+			continue
+		}
+		client, err := a.clientForResult(result)
+		if err != nil {
+			return err
+		}
+		live, err := client.Get(ctx, result.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("ERROR: could not get %s '%s/%s': %w", result.Kind, result.Namespace, result.Name, err)
+		}
+		drift := []FieldChange{}
+		for _, change := range fieldChanges("", desired.Object, live.Object) {
+			if change.Old == nil && isEmptyValue(change.New) {
+				// the server drops empty lists and maps
+				continue
+			}
+			if a.opts.isRedacted(result.Kind, change.Path) {
+				change.Old = maskValue(change.Old, redactedBefore)
+				change.New = maskValue(change.New, redactedAfter)
+			}
+			a.logf("[WARN] %s '%s/%s' did not keep %s", result.Kind, result.Namespace, result.Name, change)
+			drift = append(drift, change)
+		}
+		if len(drift) > 0 {
+			a.results[i].Drift = drift
+		}
+	}
+	return nil
+}
+
+func isEmptyValue(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
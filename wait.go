@@ -0,0 +1,207 @@
+package kedge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// pollInterval is how often wait loops check on the cluster.
+var pollInterval = 2 * time.Second
+
+// poll calls condition every pollInterval until it returns true, returns an
+// error or timeout has passed. condition is called right away the first time.
+//
+// When ctx is done, poll returns ctx.Err() without waiting for the next
+// interval. condition gets a context that is also done on timeout so
+// requests in flight are cancelled.
+func poll(ctx context.Context, timeout time.Duration, condition func(ctx context.Context) (bool, error)) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		done, err := condition(timeoutCtx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			if timeoutCtx.Err() != nil {
+				return fmt.Errorf("timed out after %s", timeout)
+			}
+			return err
+		}
+		if done {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeoutCtx.Done():
+			return fmt.Errorf("timed out after %s", timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// WaitForDeletion blocks until the object is gone or timeout passes, eg to
+// recreate an object with immutable fields once it has been deleted with
+// foreground propagation. An object that doesn't exist returns right away.
+func WaitForDeletion(config *rest.Config, gvk schema.GroupVersionKind, namespace, name string, timeout time.Duration) error {
+	return WaitForDeletionContext(context.Background(), config, gvk, namespace, name, timeout)
+}
+
+// WaitForDeletionContext is WaitForDeletion returning early with ctx.Err()
+// when ctx is done.
+func WaitForDeletionContext(ctx context.Context, config *rest.Config, gvk schema.GroupVersionKind, namespace, name string, timeout time.Duration) error {
+	namespaceableResourceClient, isNamespaced, err := newApplier(config, Options{}).namespaceableClient(gvk)
+	if err != nil {
+		return fmt.Errorf("ERROR: could not get a client to handle resource: %w", err)
+	}
+	var client dynamic.ResourceInterface = namespaceableResourceClient
+	if isNamespaced {
+		client = namespaceableResourceClient.Namespace(namespace)
+	} else {
+		namespace = ""
+	}
+	err = poll(ctx, timeout, func(ctx context.Context) (bool, error) {
+		_, err := client.Get(ctx, name, metav1.GetOptions{})
+		if kerrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return fmt.Errorf("%s '%s/%s' was not deleted: %w", gvk.Kind, namespace, name, err)
+	}
+	return nil
+}
+
+// WaitForJob blocks until the Job succeeds, fails or timeout passes. A
+// failed Job returns an error with the reason reported in its Failed
+// condition.
+//
+// When logs is not nil, the logs of the Job's pods are streamed to it as the
+// pods run.
+func WaitForJob(config *rest.Config, namespace, name string, timeout time.Duration, logs io.Writer) error {
+	return WaitForJobContext(context.Background(), config, namespace, name, timeout, logs)
+}
+
+// WaitForJobContext is WaitForJob returning early with ctx.Err() when ctx is
+// done. Log streams are stopped as well.
+func WaitForJobContext(ctx context.Context, config *rest.Config, namespace, name string, timeout time.Duration, logs io.Writer) error {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	streamCtx, cancelStreams := context.WithCancel(ctx)
+	defer cancelStreams()
+	streamer := &podLogStreamer{ctx: streamCtx, clientset: clientset, namespace: namespace, out: logs, started: map[string]bool{}}
+	err = poll(ctx, timeout, func(ctx context.Context) (bool, error) {
+		job, err := clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if logs != nil {
+			if err := streamer.streamNew(ctx, job); err != nil {
+				return false, err
+			}
+		}
+		for _, c := range job.Status.Conditions {
+			if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+				return false, fmt.Errorf("job '%s/%s' failed: %s: %s", namespace, name, c.Reason, c.Message)
+			}
+			if c.Type == batchv1.JobComplete && c.Status == corev1.ConditionTrue {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		// pods may still be running, don't wait for their logs to end
+		cancelStreams()
+	}
+	streamer.wait()
+	if err != nil {
+		return fmt.Errorf("job '%s/%s' did not complete: %s", namespace, name, err)
+	}
+	return nil
+}
+
+// podLogStreamer follows the logs of every pod that belongs to a Job. Each
+// pod is only streamed once.
+type podLogStreamer struct {
+	// ctx ends the streams. Streams otherwise end by themselves once the
+	// container exits.
+	ctx       context.Context
+	clientset kubernetes.Interface
+	namespace string
+	out       io.Writer
+
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	started map[string]bool
+}
+
+func (s *podLogStreamer) streamNew(ctx context.Context, job *batchv1.Job) error {
+	if job.Spec.Selector == nil {
+		return nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(job.Spec.Selector)
+	if err != nil {
+		return err
+	}
+	pods, err := s.clientset.CoreV1().Pods(s.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods.Items {
+		if s.started[pod.Name] || pod.Status.Phase == corev1.PodPending || pod.Status.Phase == corev1.PodUnknown {
+			continue
+		}
+		s.started[pod.Name] = true
+		s.wg.Add(1)
+		go s.stream(pod.Name)
+	}
+	return nil
+}
+
+func (s *podLogStreamer) stream(pod string) {
+	defer s.wg.Done()
+	rc, err := s.clientset.CoreV1().Pods(s.namespace).GetLogs(pod, &corev1.PodLogOptions{Follow: true}).Stream(s.ctx)
+	if err != nil {
+		s.mu.Lock()
+		fmt.Fprintf(s.out, "could not stream logs of pod '%s/%s': %s\n", s.namespace, pod, err)
+		s.mu.Unlock()
+		return
+	}
+	defer rc.Close()
+	buf := make([]byte, 4096)
+	for {
+		n, err := rc.Read(buf)
+		if n > 0 {
+			s.mu.Lock()
+			s.out.Write(buf[:n])
+			s.mu.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *podLogStreamer) wait() {
+	s.wg.Wait()
+}
@@ -0,0 +1,87 @@
+package kedge
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+// cancelAfter returns a context cancelled after d.
+func cancelAfter(t *testing.T, d time.Duration) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	time.AfterFunc(d, cancel)
+	return ctx
+}
+
+func TestPollCancelled(t *testing.T) {
+	ctx := cancelAfter(t, 50*time.Millisecond)
+	start := time.Now()
+	err := poll(ctx, time.Minute, func(ctx context.Context) (bool, error) {
+		return false, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed >= pollInterval {
+		t.Errorf("returned after %s, want before the next poll in %s", elapsed, pollInterval)
+	}
+}
+
+func TestPollCancelledDuringCondition(t *testing.T) {
+	ctx := cancelAfter(t, 50*time.Millisecond)
+	err := poll(ctx, time.Minute, func(ctx context.Context) (bool, error) {
+		<-ctx.Done()
+		return false, ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled rather than a timeout", err)
+	}
+}
+
+func TestPollTimeout(t *testing.T) {
+	err := poll(context.Background(), 50*time.Millisecond, func(ctx context.Context) (bool, error) {
+		return false, nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+}
+
+func TestPollDone(t *testing.T) {
+	calls := 0
+	err := poll(context.Background(), time.Minute, func(ctx context.Context) (bool, error) {
+		calls++
+		return true, nil
+	})
+	if err != nil || calls != 1 {
+		t.Fatalf("got %v after %d calls, want nil after 1", err, calls)
+	}
+}
+
+func TestWaitForCRDCancelled(t *testing.T) {
+	crd := &unstructured.Unstructured{}
+	crd.SetAPIVersion("apiextensions.k8s.io/v1")
+	crd.SetKind("CustomResourceDefinition")
+	crd.SetName("widgets.example.com")
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		crdResource: "CustomResourceDefinitionList",
+	}, crd)
+
+	ctx := cancelAfter(t, 50*time.Millisecond)
+	start := time.Now()
+	err := waitForCRD(ctx, client, crd.GetName(), time.Minute)
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Fatalf("got %v, want the wait to be cancelled", err)
+	}
+	if elapsed := time.Since(start); elapsed >= pollInterval {
+		t.Errorf("returned after %s, want before the next poll in %s", elapsed, pollInterval)
+	}
+}
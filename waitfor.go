@@ -0,0 +1,79 @@
+package kedge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// waitForAnnotation asks kedge to wait for a single object after applying it,
+// regardless of Options.Wait. Its value is either
+//
+//	condition=<type>[=<status>]  wait for a status condition, status defaults to True
+//	rollout                      wait like Options.Wait does for workloads
+//
+// eg `kedge.io/wait-for: condition=Available`. The wait is bounded by
+// Options.WaitTimeout.
+const waitForAnnotation = "kedge.io/wait-for"
+
+// waitFor is a parsed waitForAnnotation.
+type waitFor struct {
+	raw string
+	// conditionType is empty to wait for a rollout
+	conditionType string
+	status        string
+}
+
+func parseWaitFor(value string) (*waitFor, error) {
+	value = strings.TrimSpace(value)
+	if value == "rollout" {
+		return &waitFor{raw: value}, nil
+	}
+	parts := strings.Split(value, "=")
+	if parts[0] != "condition" || len(parts) < 2 || len(parts) > 3 || parts[1] == "" {
+		return nil, fmt.Errorf("invalid %s annotation '%s', expected condition=<type>[=<status>] or rollout", waitForAnnotation, value)
+	}
+	w := &waitFor{raw: value, conditionType: parts[1], status: "True"}
+	if len(parts) == 3 {
+		w.status = parts[2]
+	}
+	return w, nil
+}
+
+func (w *waitFor) done(obj *unstructured.Unstructured) bool {
+	if w.conditionType == "" {
+		return workloadReady(obj)
+	}
+	return hasCondition(obj, w.conditionType, w.status)
+}
+
+// waitForAnnotated waits for the objects among results whose manifest set the
+// waitForAnnotation.
+func (a *applier) waitForAnnotated(results []Result) error {
+	ctx := a.context()
+	for _, result := range results {
+		w, ok := a.waits[objectKey(result.Kind, result.Namespace, result.Name)]
+		if !ok {
+			continue
+		}
+		client, err := a.clientForResult(result)
+		if err != nil {
+			return err
+		}
+		a.logf("Waiting for %s '%s/%s' (%s)", result.Kind, result.Namespace, result.Name, w.raw)
+		err = poll(ctx, a.opts.waitTimeout(), func(ctx context.Context) (bool, error) {
+			live, err := client.Get(ctx, result.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return w.done(live), nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s '%s/%s' did not reach %s: %s", result.Kind, result.Namespace, result.Name, w.raw, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package kedge
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// warningCollector is a rest.WarningHandler keeping the warnings the API
+// server sent, eg for deprecated APIs, until they are attached to a Result.
+type warningCollector struct {
+	logger   Logger
+	mu       sync.Mutex
+	warnings []string
+}
+
+func (c *warningCollector) HandleWarningHeader(code int, agent string, text string) {
+	if code != 299 || text == "" {
+		return
+	}
+	c.add(text)
+}
+
+// add logs text and keeps it for the next Result, for warnings of kedge
+// itself.
+func (c *warningCollector) add(text string) {
+	c.logger.Printf("[WARN] %s", text)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warnings = append(c.warnings, text)
+}
+
+// take returns the warnings collected so far and resets the collector.
+func (c *warningCollector) take() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	warnings := c.warnings
+	c.warnings = nil
+	return warnings
+}
+
+// record adds the result of an object along with the warnings the API server
+// sent while handling it.
+func (a *applier) record(result Result) error {
+	if a.warnings != nil {
+		result.Warnings = a.warnings.take()
+	}
+	key := objectKey(result.Kind, result.Namespace, result.Name)
+	if a.replacing[key] && (result.Action == ActionCreated || result.Action == ActionApplied) {
+		delete(a.replacing, key)
+		result.Action = ActionReplaced
+	}
+	a.results = append(a.results, result)
+	a.state.applied(result)
+	if a.opts.WarningsAsErrors && len(result.Warnings) > 0 {
+		return fmt.Errorf("%s '%s/%s' got warnings from the API server: %s", result.Kind, result.Namespace, result.Name, strings.Join(result.Warnings, "; "))
+	}
+	return nil
+}